@@ -0,0 +1,179 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"sort"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/model"
+	"github.com/tinywasm/router"
+)
+
+// AdminAuth authorizes an admin request. It returns nil to allow it, or an
+// error to reject it: an *SSEError (e.g. Unauthorized, Forbidden) sets the
+// status code, any other error is answered with 403.
+type AdminAuth func(ctx router.Context) error
+
+// AdminAPI serves JSON handlers to inspect and control a running server.
+// Every handler runs the AdminAuth first. Mount them on a router, e.g.:
+//
+//	admin := server.Admin(checkOperator)
+//	r.Get("/sse/admin/connections", admin.Connections())
+//	r.Get("/sse/admin/channels", admin.Channels())
+//	r.Get("/sse/admin/history", admin.History())
+//	r.Get("/sse/admin/history/*", admin.History())
+//	r.Get("/sse/admin/stats", admin.Stats())
+//	r.Post("/sse/admin/publish", admin.Publish())
+//	r.Post("/sse/admin/disconnect", admin.Disconnect())
+type AdminAPI struct {
+	server *SSEServer
+	auth   AdminAuth
+}
+
+// Admin returns the admin handlers of s guarded by auth.
+// A nil auth rejects every request.
+func (s *SSEServer) Admin(auth AdminAuth) *AdminAPI {
+	return &AdminAPI{server: s, auth: auth}
+}
+
+// Connections lists open connections:
+// {"connections":[AdminConnection...]}, oldest first.
+func (a *AdminAPI) Connections() func(ctx router.Context) {
+	return a.handle(func(ctx router.Context) {
+		conns := a.server.Connections()
+		items := make([]model.Encodable, len(conns))
+		for i, c := range conns {
+			items[i] = &AdminConnection{
+				Id:          c.ID,
+				Key:         c.Key,
+				Meta:        c.Meta,
+				Channels:    JoinSlice(c.Channels, ","),
+				ConnectedAt: c.ConnectedAt.Unix(),
+			}
+		}
+		writeJSON(ctx, 200, &adminList{name: "connections", items: items})
+	})
+}
+
+// Channels lists channels with subscribers:
+// {"channels":[AdminChannel...]}, sorted by name.
+func (a *AdminAPI) Channels() func(ctx router.Context) {
+	return a.handle(func(ctx router.Context) {
+		var channels []*AdminChannel
+		a.server.hub.do(func() {
+			for name, n := range a.server.hub.subscribers {
+				channels = append(channels, &AdminChannel{Name: name, Subscribers: int64(n)})
+			}
+		})
+		sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+		items := make([]model.Encodable, len(channels))
+		for i, c := range channels {
+			items[i] = c
+		}
+		writeJSON(ctx, 200, &adminList{name: "channels", items: items})
+	})
+}
+
+// History returns the replay history: {"messages":[SSEMessage...]}, oldest
+// first. A path ending in "/history/<channel>" filters by channel.
+func (a *AdminAPI) History() func(ctx router.Context) {
+	return a.handle(func(ctx router.Context) {
+		channel := ""
+		path := ctx.Path()
+		if i := Index(path, "/history/"); i >= 0 {
+			channel = path[i+len("/history/"):]
+		}
+
+		h := a.server.hub
+		h.historyMutex.RLock()
+		var items []model.Encodable
+		for _, item := range h.history {
+			if channel == "" || containsString(item.channels, channel) {
+				items = append(items, item.msg)
+			}
+		}
+		h.historyMutex.RUnlock()
+		writeJSON(ctx, 200, &adminList{name: "messages", items: items})
+	})
+}
+
+// Stats returns hub totals as an AdminStats.
+func (a *AdminAPI) Stats() func(ctx router.Context) {
+	return a.handle(func(ctx router.Context) {
+		s := a.server
+		stats := &AdminStats{
+			Frames: s.traffic.frames.Load(),
+			Bytes:  s.traffic.bytes.Load(),
+		}
+		s.hub.do(func() {
+			stats.Connections = int64(len(s.hub.clients))
+			stats.Channels = int64(len(s.hub.subscribers))
+			stats.LastId = Convert(s.hub.lastID).String()
+		})
+		s.hub.historyMutex.RLock()
+		stats.History = int64(len(s.hub.history))
+		s.hub.historyMutex.RUnlock()
+		writeJSON(ctx, 200, stats)
+	})
+}
+
+// Publish publishes a test event, read like PublishHandler does, and
+// answers 204.
+func (a *AdminAPI) Publish() func(ctx router.Context) {
+	return a.handle(func(ctx router.Context) {
+		data, opts, ok := readPublishRequest(ctx)
+		if !ok {
+			return
+		}
+		a.server.publishRequest(ctx, data, opts)
+	})
+}
+
+// Disconnect closes the connection named by the AdminDisconnect in the
+// request body. Answers 204, or 404 when it is not connected.
+func (a *AdminAPI) Disconnect() func(ctx router.Context) {
+	return a.handle(func(ctx router.Context) {
+		var req AdminDisconnect
+		if !readJSON(ctx, &req) {
+			return
+		}
+		if !a.server.Disconnect(req.Id) {
+			writeError(ctx, 404, "connection not found")
+			return
+		}
+		ctx.WriteStatus(204)
+	})
+}
+
+// handle wraps fn with the auth check.
+func (a *AdminAPI) handle(fn func(ctx router.Context)) func(ctx router.Context) {
+	return func(ctx router.Context) {
+		if a.auth == nil {
+			writeError(ctx, 403, "admin API not authorized")
+			return
+		}
+		if err := a.auth(ctx); err != nil {
+			a.server.tinySSE.log(LevelWarn, LogAdmin, "path", ctx.Path(), "error", err)
+			writeFailure(ctx, err, 403)
+			return
+		}
+		fn(ctx)
+	}
+}
+
+// adminList encodes items as {"<name>":[...]}.
+type adminList struct {
+	name  string
+	items []model.Encodable
+}
+
+func (l *adminList) IsNil() bool { return l == nil }
+
+func (l *adminList) EncodeFields(w model.FieldWriter) {
+	aw := w.Array(l.name, len(l.items))
+	for _, item := range l.items {
+		aw.Object(item)
+	}
+	aw.Close()
+}
@@ -0,0 +1,112 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// tokenBucket admits connection attempts at a steady rate with bursts.
+// Tokens may go negative: each negative token is a reservation held by a
+// queued attempt, so the deficit is the length of the admission queue.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token if one becomes available within maxWait and returns
+// how long the caller must wait before using it. Otherwise it takes nothing
+// and returns false with the time until the queue drains.
+func (b *tokenBucket) reserve(maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wait := b.wait()
+	if wait <= 0 {
+		b.tokens--
+		return 0, true
+	}
+	if wait > maxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// wait refills the bucket and returns how long a new attempt would wait for
+// a token. Must be called with mu held.
+func (b *tokenBucket) wait() time.Duration {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket holds its whole burst, as when new.
+func (b *tokenBucket) full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.wait()
+	return b.tokens >= b.burst
+}
+
+// pending returns how long a new attempt would wait, without taking a token.
+func (b *tokenBucket) pending() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.wait()
+}
+
+// admitStream applies AdmissionRate to a new stream. Attempts are queued for
+// up to AdmissionMaxWait; beyond that they get a "retry:" hint and are closed.
+// Reports whether the stream may proceed.
+func (s *SSEServer) admitStream(st router.Streamer) bool {
+	if s.admission == nil {
+		return true
+	}
+	wait, ok := s.admission.reserve(s.config.AdmissionMaxWait)
+	if ok {
+		if wait > 0 {
+			s.hub.metrics.Add(MetricConnectionsQueued, 1)
+			time.Sleep(wait)
+		}
+		return true
+	}
+
+	jitter := s.config.AdmissionJitter
+	if jitter <= 0 {
+		jitter = time.Second
+	}
+	retry := (wait + rand.N(jitter)).Milliseconds()
+
+	s.hub.metrics.Add(MetricConnectionsThrottled, 1)
+	s.tinySSE.log(LevelWarn, LogThrottled, "retry_ms", retry)
+
+	// A 200 stream carrying only "retry:" makes the browser reconnect natively
+	// after the hinted delay, instead of failing like on a 429.
+	st.SetHeader("Content-Type", "text/event-stream")
+	st.SetHeader("Cache-Control", "no-cache")
+	st.SetHeader("Retry-After", Convert((retry+999)/1000).String())
+	st.WriteStatus(200)
+	st.Write([]byte("retry: " + Convert(retry).String() + "\n\n")) //nolint:errcheck
+	st.Flush()
+	return false
+}
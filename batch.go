@@ -0,0 +1,80 @@
+//go:build !wasm
+
+package sse
+
+import "time"
+
+// fillBatch waits up to BatchMaxDelay for more messages while batch is below
+// BatchMaxBytes. Without batching it returns batch unchanged.
+func (s *SSEServer) fillBatch(q *sendQueue, batch []*outbound) []*outbound {
+	if s.config.BatchMaxBytes <= 0 || s.config.BatchMaxDelay <= 0 {
+		return batch
+	}
+	deadline := time.Now().Add(s.config.BatchMaxDelay)
+	for batchSize(batch) < s.config.BatchMaxBytes {
+		more := q.popUntil(deadline)
+		if len(more) == 0 {
+			break
+		}
+		batch = append(batch, more...)
+	}
+	return batch
+}
+
+// writeBatch writes batch to st. With BatchMaxBytes set, consecutive messages
+// are coalesced into one Write and one Flush per BatchMaxBytes chunk (a single
+// larger message is written alone); otherwise each message is flushed on its own.
+// Messages that expired while queued are dropped.
+func (s *SSEServer) writeBatch(w *streamWriter, client *clientConnection, batch []*outbound) error {
+	batch = s.dropExpired(batch)
+	for len(batch) > 0 {
+		n, size := 1, len(batch[0].data)
+		if s.config.BatchMaxBytes > 0 {
+			for n < len(batch) && size+len(batch[n].data) <= s.config.BatchMaxBytes {
+				size += len(batch[n].data)
+				n++
+			}
+		}
+		chunk := batch[:n]
+		batch = batch[n:]
+
+		buf := chunk[0].data
+		if n > 1 {
+			buf = make([]byte, 0, size)
+			for _, out := range chunk {
+				buf = append(buf, out.data...)
+			}
+		}
+
+		start := time.Now()
+		if err := w.write(buf); err != nil {
+			return err
+		}
+		s.traffic.add(size, n)
+		s.hub.metrics.Observe(MetricWriteSeconds, time.Since(start).Seconds())
+
+		delivered := 0
+		for _, out := range chunk {
+			if out.control {
+				continue
+			}
+			delivered++
+			if out.written != nil {
+				out.written()
+			}
+			if s.config.OnDeliver != nil {
+				s.config.OnDeliver(client.info(), out.msg)
+			}
+		}
+		s.hub.metrics.Add(MetricMessagesDelivered, float64(delivered))
+	}
+	return nil
+}
+
+func batchSize(batch []*outbound) int {
+	size := 0
+	for _, out := range batch {
+		size += len(out.data)
+	}
+	return size
+}
@@ -0,0 +1,114 @@
+//go:build !wasm
+
+package sse
+
+import "sort"
+
+// catchUp collects what a connection missed (cached state, history replay,
+// inbox and reliable redelivery) so it is queued once and in ID order:
+// the last ID the client sees stays a valid Last-Event-ID.
+type catchUp struct {
+	items []catchUpItem
+	seen  map[string]int // index in items by message ID
+}
+
+type catchUpItem struct {
+	out   *outbound
+	force bool // queued even when full; otherwise dropped like live traffic
+}
+
+func newCatchUp() *catchUp {
+	return &catchUp{seen: make(map[string]int)}
+}
+
+// add collects out unless a message with its ID already was; then out's
+// written callback moves to the collected one. Control events have no ID and
+// are always collected. Reports whether it was added.
+func (c *catchUp) add(out *outbound, force bool) bool {
+	if id := out.msg.Id; id != "" {
+		if i, ok := c.seen[id]; ok {
+			c.chainWritten(i, out.written)
+			return false
+		}
+		c.seen[id] = len(c.items)
+	}
+	c.items = append(c.items, catchUpItem{out: out, force: force})
+	return true
+}
+
+// chainWritten makes item i call written too once written. The item may be
+// shared with other connections, so it is replaced by a copy.
+func (c *catchUp) chainWritten(i int, written func()) {
+	if written == nil {
+		return
+	}
+	out := *c.items[i].out
+	if prev := out.written; prev != nil {
+		out.written = func() {
+			prev()
+			written()
+		}
+	} else {
+		out.written = written
+	}
+	c.items[i].out = &out
+}
+
+// finishCatchUp adds the inbox of client's channels to cu and queues it.
+// Store reads run on the inbox goroutine; until they are back, messages for
+// client are collected in cu too, so everything still arrives in ID order.
+// Must run on the hub goroutine.
+func (h *hub) finishCatchUp(client *clientConnection, channels []string, cu *catchUp) {
+	var inbox []string
+	if h.inbox != nil {
+		for _, ch := range channels {
+			if matchAnyChannel(h.config.InboxChannels, ch) {
+				inbox = append(inbox, ch)
+			}
+		}
+	}
+	if client.catchUp != nil {
+		for _, item := range cu.items {
+			client.catchUp.add(item.out, item.force)
+		}
+		cu = client.catchUp
+	}
+	if len(inbox) == 0 {
+		if client.inboxReads == 0 {
+			h.queueCatchUp(client, cu)
+		}
+		return
+	}
+
+	client.catchUp = cu
+	client.inboxReads++
+	h.inboxQueue.do(func() {
+		read := h.readInbox(client, inbox)
+		h.exec <- func() {
+			read(cu)
+			client.inboxReads--
+			if client.inboxReads > 0 {
+				return
+			}
+			client.catchUp = nil
+			if h.clients[client] {
+				h.queueCatchUp(client, cu)
+			}
+		}
+	})
+}
+
+// queueCatchUp queues the collected messages to client, oldest first.
+// Must run on the hub goroutine.
+func (h *hub) queueCatchUp(client *clientConnection, c *catchUp) {
+	sort.SliceStable(c.items, func(i, j int) bool {
+		return idAfter(c.items[j].out.msg.Id, c.items[i].out.msg.Id)
+	})
+	for _, item := range c.items {
+		if item.force {
+			client.queue.push(item.out, true)
+			continue
+		}
+		h.enqueue(client, item.out)
+	}
+}
@@ -17,8 +17,32 @@ type SSEClient struct {
 	es                js.Value
 	reconnectAttempts int
 	lastEventID       string
+	connID            string // from ConnectedEvent; empty while not connected
+
+	// Reliable mode (ClientConfig.AckEndpoint).
+	seen         map[string]bool // recently handled message IDs
+	seenOrder    []string        // seen IDs, oldest first
+	acks         []string        // IDs waiting to be acknowledged
+	ackScheduled bool
+
+	calls   map[string]*pendingCall // by correlation ID
+	callSeq int
+}
+
+// pendingCall is a Call waiting for its ReplyEvent.
+type pendingCall struct {
+	method  string
+	done    func(reply *SSEMessage, err error)
+	timer   js.Value // setTimeout ID of the timeout
+	timeout js.Func
 }
 
+// seenWindow is how many recent message IDs are remembered for deduplication.
+const seenWindow = 1024
+
+// defaultCallTimeout is used when ClientConfig.CallTimeout is 0.
+const defaultCallTimeout = 30000
+
 // Client creates a new SSEClient instance.
 func (t *tinySSE) Client(c *ClientConfig) *SSEClient {
 	return &SSEClient{
@@ -71,11 +95,19 @@ func (c *SSEClient) Connect() {
 			c.lastEventID = eventID
 		}
 
+		// Reliable mode: acknowledge every ID, handle each only once.
+		if eventID != "" && c.config.AckEndpoint != "" {
+			c.ack(eventID)
+			if c.markSeen(eventID) {
+				return nil
+			}
+		}
+
 		if c.handler != nil {
 			msg := &SSEMessage{
 				Id:    eventID,
 				Event: eventType,
-				Data:  []byte(dataStr), // Raw bytes from string
+				Data:  DecodePayload([]byte(dataStr)), // Raw bytes, base64 payloads decoded
 			}
 			c.handler(msg)
 		}
@@ -88,17 +120,64 @@ func (c *SSEClient) Connect() {
 		// readyState: 0=CONNECTING, 1=OPEN, 2=CLOSED
 		readyState := c.es.Get("readyState").Int()
 
-		if c.errorHandler != nil {
-			// Construct a meaningful error
-			// We can't get much detail from EventSource error event in browser for security reasons often.
-			// But we can report state.
-			c.errorHandler(fmt.Err("SSE connection error", "readyState", readyState))
+		// CONNECTING: the browser is retrying natively after a network glitch.
+		if readyState != 2 {
+			c.reportError(&SSEError{Kind: ErrorConnection, Message: "connection lost, retrying"})
+			return nil
 		}
 
-		// If CLOSED (2), browser gave up (e.g. fatal error). We can try manual reconnect.
-		if readyState == 2 {
-			c.reconnect()
+		// CLOSED: the browser gave up, usually because the server rejected the
+		// stream. EventSource hides the HTTP status, so probe the endpoint to
+		// classify the rejection before deciding whether to reconnect.
+		c.probe(func(err *SSEError) {
+			c.reportError(err)
+			switch err.Kind {
+			case ErrorUnauthorized, ErrorForbidden, ErrorGone:
+				// Retrying cannot succeed without application action.
+				c.Close()
+			case ErrorRateLimited:
+				if err.RetryAfter > 0 {
+					c.reconnectAfter(err.RetryAfter * 1000)
+				} else {
+					c.reconnect() // no hint: back off from RetryInterval
+				}
+			default:
+				c.reconnect()
+			}
+		})
+		return nil
+	}))
+
+	c.es.Call("addEventListener", ConnectedEvent, js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		// Replies to calls made on a previous stream cannot arrive anymore.
+		c.failCalls("connection replaced")
+		c.connID = args[0].Get("data").String()
+		c.flushAcks() // acknowledgements collected while reconnecting
+		return nil
+	}))
+
+	c.es.Call("addEventListener", ReplyEvent, js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		id, kind, payload, ok := decodeReply([]byte(args[0].Get("data").String()))
+		if !ok {
+			return nil
 		}
+		call := c.calls[id]
+		if call == nil {
+			return nil // canceled or timed out
+		}
+		if kind != "" {
+			c.resolveCall(id, nil, &SSEError{Kind: parseErrorKind(kind, 0), Message: string(payload)})
+			return nil
+		}
+		c.resolveCall(id, &SSEMessage{Id: id, Event: call.method, Data: payload}, nil)
+		return nil
+	}))
+
+	// The server replaced this connection with a newer one of the same key:
+	// reconnecting would only evict the newer one in turn.
+	c.es.Call("addEventListener", EvictedEvent, js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		c.Close()
+		c.reportError(&SSEError{Kind: ErrorEvicted, Message: "replaced by a newer connection"})
 		return nil
 	}))
 
@@ -111,11 +190,95 @@ func (c *SSEClient) Connect() {
 
 // Close closes the SSE connection.
 func (c *SSEClient) Close() {
+	c.connID = ""
+	c.failCalls("connection closed")
 	if !c.es.IsUndefined() && !c.es.IsNull() {
 		c.es.Call("close")
 	}
 }
 
+// ConnectionID returns the server-assigned ID of the open stream, or "" while
+// not connected. It changes on every reconnection.
+func (c *SSEClient) ConnectionID() string {
+	return c.connID
+}
+
+// Send posts a message upstream to ClientConfig.SendEndpoint on behalf of the
+// open stream; the server passes it to ServerConfig.OnReceive. It fails
+// immediately when not connected; delivery failures are reported to OnError.
+func (c *SSEClient) Send(event string, data []byte) error {
+	if c.config.SendEndpoint == "" {
+		return fmt.Err("send endpoint not configured")
+	}
+	if c.connID == "" {
+		return fmt.Err("not connected")
+	}
+
+	c.post(c.config.SendEndpoint, map[string]string{HeaderPublishEvent: event}, data, "send "+event, c.reportError)
+	return nil
+}
+
+// Call invokes method on the server through ClientConfig.CallEndpoint and
+// calls done once with the reply (an SSEMessage with the call's correlation
+// ID, the method as Event and the result as Data) or an error: the server's
+// rejection or ReplyError, ErrorTimeout after CallTimeout, ErrorCanceled, or
+// ErrorConnection when the stream closes first. The returned cancel func
+// fails the call with ErrorCanceled unless it is already resolved.
+func (c *SSEClient) Call(method string, data []byte, done func(reply *SSEMessage, err error)) (cancel func()) {
+	if c.config.CallEndpoint == "" {
+		done(nil, fmt.Err("call endpoint not configured"))
+		return func() {}
+	}
+	if c.connID == "" {
+		done(nil, &SSEError{Kind: ErrorConnection, Message: "not connected"})
+		return func() {}
+	}
+
+	c.callSeq++
+	id := fmt.Convert(c.callSeq).String()
+	call := &pendingCall{method: method, done: done}
+	if c.calls == nil {
+		c.calls = make(map[string]*pendingCall)
+	}
+	c.calls[id] = call
+
+	timeout := c.config.CallTimeout
+	if timeout <= 0 {
+		timeout = defaultCallTimeout
+	}
+	call.timeout = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		c.resolveCall(id, nil, &SSEError{Kind: ErrorTimeout, Message: method + " timed out"})
+		return nil
+	})
+	call.timer = js.Global().Call("setTimeout", call.timeout, timeout)
+
+	c.post(c.config.CallEndpoint, map[string]string{HeaderPublishEvent: method, HeaderCall: id}, data, "call "+method,
+		func(err *SSEError) { c.resolveCall(id, nil, err) })
+
+	return func() {
+		c.resolveCall(id, nil, &SSEError{Kind: ErrorCanceled, Message: method + " canceled"})
+	}
+}
+
+// resolveCall completes the pending call id, if any.
+func (c *SSEClient) resolveCall(id string, reply *SSEMessage, err error) {
+	call := c.calls[id]
+	if call == nil {
+		return
+	}
+	delete(c.calls, id)
+	js.Global().Call("clearTimeout", call.timer)
+	call.timeout.Release()
+	call.done(reply, err)
+}
+
+// failCalls fails every pending call with ErrorConnection.
+func (c *SSEClient) failCalls(reason string) {
+	for id := range c.calls {
+		c.resolveCall(id, nil, &SSEError{Kind: ErrorConnection, Message: reason})
+	}
+}
+
 // OnMessage sets the handler for incoming messages.
 func (c *SSEClient) OnMessage(handler func(msg *SSEMessage)) {
 	c.handler = handler
@@ -126,13 +289,167 @@ func (c *SSEClient) OnError(handler func(err error)) {
 	c.errorHandler = handler
 }
 
-func (c *SSEClient) reconnect() {
-	c.Close()
+// reportError forwards err to the OnError handler, if any.
+func (c *SSEClient) reportError(err *SSEError) {
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
 
-	if c.config.MaxReconnectAttempts > 0 && c.reconnectAttempts >= c.config.MaxReconnectAttempts {
-		if c.errorHandler != nil {
-			c.errorHandler(fmt.Err("max reconnect attempts reached"))
+// markSeen records id and reports whether it was already handled.
+func (c *SSEClient) markSeen(id string) bool {
+	if c.seen[id] {
+		return true
+	}
+	if c.seen == nil {
+		c.seen = make(map[string]bool, seenWindow)
+	}
+	c.seen[id] = true
+	c.seenOrder = append(c.seenOrder, id)
+	if len(c.seenOrder) > seenWindow {
+		delete(c.seen, c.seenOrder[0])
+		c.seenOrder = c.seenOrder[1:]
+	}
+	return false
+}
+
+// ack queues id for the next acknowledgement batch.
+func (c *SSEClient) ack(id string) {
+	c.acks = append(c.acks, id)
+	if c.ackScheduled {
+		return
+	}
+	c.ackScheduled = true
+
+	var flush js.Func
+	flush = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		flush.Release()
+		c.ackScheduled = false
+		c.flushAcks()
+		return nil
+	})
+	js.Global().Call("setTimeout", flush, c.config.AckInterval)
+}
+
+// flushAcks posts the queued acknowledgements. While not connected they are
+// kept for the next stream; a lost batch is covered by redelivery.
+func (c *SSEClient) flushAcks() {
+	if len(c.acks) == 0 || c.connID == "" {
+		return
+	}
+	body := fmt.JoinSlice(c.acks, ",")
+	c.acks = nil
+	c.post(c.config.AckEndpoint, nil, []byte(body), "ack", c.reportError)
+}
+
+// post sends body to url on behalf of the open stream and passes a failed
+// request to fail as "<what> failed".
+func (c *SSEClient) post(url string, header map[string]string, body []byte, what string, fail func(err *SSEError)) {
+	headers := js.Global().Get("Object").New()
+	headers.Set(HeaderConnection, c.connID)
+	for k, v := range header {
+		headers.Set(k, v)
+	}
+	jsBody := js.Global().Get("Uint8Array").New(len(body))
+	js.CopyBytesToJS(jsBody, body)
+
+	opts := js.Global().Get("Object").New()
+	opts.Set("method", "POST")
+	opts.Set("headers", headers)
+	opts.Set("body", jsBody)
+
+	var onResponse, onFail js.Func
+	release := func() {
+		onResponse.Release()
+		onFail.Release()
+	}
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		resp := args[0]
+		if !resp.Get("ok").Bool() {
+			status := resp.Get("status").Int()
+			fail(&SSEError{
+				Kind:    parseErrorKind(resp.Get("headers").Call("get", ErrorHeader).String(), status),
+				Status:  status,
+				Message: what + " failed",
+			})
+		}
+		return nil
+	})
+	onFail = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		fail(&SSEError{Kind: ErrorConnection, Message: what + " failed"})
+		return nil
+	})
+
+	js.Global().Call("fetch", url, opts).Call("then", onResponse, onFail)
+}
+
+// probe asks the endpoint (with HeaderProbe, so no stream is opened) for the
+// status code, ErrorHeader, Retry-After and body of a rejected stream.
+func (c *SSEClient) probe(done func(err *SSEError)) {
+	fetch := js.Global().Get("fetch")
+	if fetch.IsUndefined() {
+		done(&SSEError{Kind: ErrorConnection, Message: "connection closed"})
+		return
+	}
+
+	ctl := js.Global().Get("AbortController").New()
+	headers := js.Global().Get("Object").New()
+	headers.Set(HeaderProbe, "1")
+	opts := js.Global().Get("Object").New()
+	opts.Set("signal", ctl.Get("signal"))
+	opts.Set("headers", headers)
+
+	var onResponse, onText, onFail js.Func
+	release := func() {
+		onResponse.Release()
+		onText.Release()
+		onFail.Release()
+	}
+
+	var sseErr *SSEError
+	onText = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		sseErr.Message = fmt.Convert(args[0].String()).TrimSpace().String()
+		release()
+		done(sseErr)
+		return nil
+	})
+	onFail = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		release()
+		done(&SSEError{Kind: ErrorConnection, Message: "connection closed"})
+		return nil
+	})
+	onResponse = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resp := args[0]
+		status := resp.Get("status").Int()
+		if status == 200 {
+			// The stream is accepted again: the failure was transient.
+			ctl.Call("abort")
+			release()
+			done(&SSEError{Kind: ErrorConnection, Status: status, Message: "connection closed"})
+			return nil
 		}
+
+		headers := resp.Get("headers")
+		sseErr = &SSEError{
+			Kind:   parseErrorKind(headers.Call("get", ErrorHeader).String(), status),
+			Status: status,
+		}
+		if retry := headers.Call("get", "Retry-After"); !retry.IsNull() {
+			sseErr.RetryAfter, _ = fmt.Convert(retry.String()).Int()
+		}
+		resp.Call("text").Call("then", onText, onFail)
+		return nil
+	})
+
+	fetch.Invoke(c.config.Endpoint, opts).Call("then", onResponse, onFail)
+}
+
+func (c *SSEClient) reconnect() {
+	if c.config.MaxReconnectAttempts > 0 && c.reconnectAttempts >= c.config.MaxReconnectAttempts {
+		c.Close()
+		c.reportError(&SSEError{Kind: ErrorMaxRetries, Message: "max reconnect attempts reached"})
 		return
 	}
 
@@ -143,6 +460,12 @@ func (c *SSEClient) reconnect() {
 	if delay <= 0 {
 		delay = 1000 // Default 1s if misconfigured
 	}
+	c.reconnectAfter(delay)
+}
+
+// reconnectAfter closes the current stream and connects again after delay ms.
+func (c *SSEClient) reconnectAfter(delay int) {
+	c.Close()
 
 	js.Global().Call("setTimeout", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		c.Connect()
@@ -7,6 +7,27 @@ type ClientConfig struct {
 	// Endpoint is the SSE server URL.
 	Endpoint string
 
+	// SendEndpoint is the URL of the server's ReceiveHandler, used by
+	// SSEClient.Send. Empty = Send is disabled.
+	SendEndpoint string
+
+	// CallEndpoint is the URL of the server's CallHandler, used by
+	// SSEClient.Call. Empty = Call is disabled.
+	CallEndpoint string
+
+	// CallTimeout fails calls without a reply after this many milliseconds.
+	// 0 = 30 seconds.
+	CallTimeout int
+
+	// AckEndpoint is the URL of the server's AckHandler. Setting it enables
+	// reliable mode: received message IDs are acknowledged and messages
+	// redelivered by the server are passed to OnMessage only once.
+	AckEndpoint string
+
+	// AckInterval batches acknowledgements for this many milliseconds.
+	// 0 = acknowledge on the next tick.
+	AckInterval int
+
 	// RetryInterval in milliseconds for reconnection.
 	RetryInterval int
 
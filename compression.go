@@ -0,0 +1,246 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"sync/atomic"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// compressor is a streaming encoder flushed after every write.
+type compressor interface {
+	io.Writer
+	Flush() error
+	Close() error
+}
+
+// streamWriter writes frames to a Streamer, optionally through a compressor.
+type streamWriter struct {
+	st  router.Streamer
+	enc compressor // nil = identity
+}
+
+// streamerIO adapts router.Streamer to io.Writer for the compressor.
+type streamerIO struct{ st router.Streamer }
+
+func (w streamerIO) Write(b []byte) (int, error) { return w.st.Write(b) }
+
+// write sends b and pushes it to the client: the compressor is sync-flushed
+// so latency is the same as for an uncompressed stream.
+func (w *streamWriter) write(b []byte) error {
+	if w.enc == nil {
+		if _, err := w.st.Write(b); err != nil {
+			return err
+		}
+	} else {
+		if _, err := w.enc.Write(b); err != nil {
+			return err
+		}
+		if err := w.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	w.st.Flush()
+	return nil
+}
+
+// close terminates the compressed stream (best effort).
+func (w *streamWriter) close() {
+	if w.enc != nil {
+		w.enc.Close() //nolint:errcheck
+	}
+}
+
+// frameCompressor applies CompressionMinBytes per write: each write becomes
+// its own deflate blocks, stored as is when smaller than min and compressed
+// otherwise. Compressed writes do not use earlier ones as dictionary, so that
+// stored blocks can sit between them. The gzip or zlib container is written
+// by hand around the raw deflate data.
+type frameCompressor struct {
+	out  io.Writer
+	enc  *flate.Writer
+	buf  bytes.Buffer
+	min  int
+	zlib bool
+
+	started bool
+	crc     uint32      // gzip checksum
+	adler   hash.Hash32 // zlib checksum
+	size    uint32
+}
+
+func newFrameCompressor(out io.Writer, level, min int, zlib bool) (*frameCompressor, error) {
+	enc, err := flate.NewWriter(nil, level)
+	if err != nil {
+		return nil, err
+	}
+	return &frameCompressor{out: out, enc: enc, min: min, zlib: zlib, adler: adler32.New()}, nil
+}
+
+// Containers headers: gzip with no name or time, zlib with default level.
+var (
+	gzipHeader = []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+	zlibHeader = []byte{0x78, 0x9c}
+)
+
+func (c *frameCompressor) Write(b []byte) (int, error) {
+	c.buf.Reset()
+	if !c.started {
+		c.started = true
+		if c.zlib {
+			c.buf.Write(zlibHeader)
+		} else {
+			c.buf.Write(gzipHeader)
+		}
+	}
+	if c.zlib {
+		c.adler.Write(b) //nolint:errcheck // never fails
+	} else {
+		c.crc = crc32.Update(c.crc, crc32.IEEETable, b)
+	}
+	c.size += uint32(len(b))
+
+	if len(b) < c.min {
+		appendStored(&c.buf, b, false)
+	} else {
+		// Reset drops the window; Flush ends on a byte-aligned empty block.
+		c.enc.Reset(&c.buf)
+		c.enc.Write(b) //nolint:errcheck // writes to a bytes.Buffer
+		c.enc.Flush()  //nolint:errcheck
+	}
+	if _, err := c.out.Write(c.buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush implements compressor: every Write is already complete.
+func (c *frameCompressor) Flush() error { return nil }
+
+// Close ends the deflate data and writes the container trailer.
+func (c *frameCompressor) Close() error {
+	if !c.started {
+		return nil
+	}
+	c.buf.Reset()
+	appendStored(&c.buf, nil, true)
+	if c.zlib {
+		c.buf.Write(binary.BigEndian.AppendUint32(nil, c.adler.Sum32()))
+	} else {
+		c.buf.Write(binary.LittleEndian.AppendUint32(nil, c.crc))
+		c.buf.Write(binary.LittleEndian.AppendUint32(nil, c.size))
+	}
+	_, err := c.out.Write(c.buf.Bytes())
+	return err
+}
+
+// appendStored writes b as uncompressed deflate blocks; final marks the last
+// block of the stream.
+func appendStored(buf *bytes.Buffer, b []byte, final bool) {
+	for {
+		n := min(len(b), 0xffff)
+		last := byte(0)
+		if final && n == len(b) {
+			last = 1
+		}
+		buf.WriteByte(last) // BFINAL, BTYPE=00, padded to the byte
+		buf.Write(binary.LittleEndian.AppendUint16(nil, uint16(n)))
+		buf.Write(binary.LittleEndian.AppendUint16(nil, ^uint16(n)))
+		buf.Write(b[:n])
+		b = b[n:]
+		if len(b) == 0 {
+			return
+		}
+	}
+}
+
+// trafficStats tracks delivered frames and bytes (see AdminAPI.Stats).
+type trafficStats struct {
+	bytes  atomic.Int64
+	frames atomic.Int64
+}
+
+func (t *trafficStats) add(bytes, frames int) {
+	t.bytes.Add(int64(bytes))
+	t.frames.Add(int64(frames))
+}
+
+// negotiateEncoding picks the response encoding for st and sets the headers.
+// Must be called before the header flush.
+func (s *SSEServer) negotiateEncoding(st router.Streamer) *streamWriter {
+	w := &streamWriter{st: st}
+	if !s.config.Compression {
+		return w
+	}
+	st.SetHeader("Vary", "Accept-Encoding")
+
+	level := s.config.CompressionLevel
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var err error
+	encoding := acceptedEncoding(st.GetHeader("Accept-Encoding"))
+	switch {
+	case encoding == "":
+		return w
+	case s.config.CompressionMinBytes > 0:
+		w.enc, err = newFrameCompressor(streamerIO{st}, level, s.config.CompressionMinBytes, encoding == "deflate")
+	case encoding == "gzip":
+		w.enc, err = gzip.NewWriterLevel(streamerIO{st}, level)
+	default:
+		w.enc, err = zlib.NewWriterLevel(streamerIO{st}, level)
+	}
+	if err != nil {
+		s.tinySSE.log(LevelError, LogCompression, "error", err)
+		w.enc = nil
+		return w
+	}
+	st.SetHeader("Content-Encoding", encoding)
+	return w
+}
+
+// acceptedEncoding returns "gzip", "deflate" or "" from an Accept-Encoding
+// header, preferring gzip and honoring q=0 exclusions. "*" only stands for
+// encodings the header does not name.
+func acceptedEncoding(header string) string {
+	accepted := make(map[string]bool) // listed names; false = refused with q=0
+	for _, part := range Split(header, ",") {
+		fields := Split(part, ";")
+		name := ToLower(TrimSpace(fields[0]))
+		excluded := false
+		for _, param := range fields[1:] {
+			param = TrimSpace(param)
+			if !HasPrefix(param, "q=") {
+				continue
+			}
+			if q, err := Convert(TrimPrefix(param, "q=")).Float64(); err == nil && q == 0 {
+				excluded = true
+			}
+		}
+		if name == "x-gzip" {
+			name = "gzip"
+		}
+		if ok, listed := accepted[name]; !listed || ok {
+			accepted[name] = !excluded
+		}
+	}
+	for _, encoding := range []string{"gzip", "deflate"} {
+		ok, listed := accepted[encoding]
+		if ok || (!listed && accepted["*"]) {
+			return encoding
+		}
+	}
+	return ""
+}
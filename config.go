@@ -3,6 +3,13 @@ package sse
 // Config holds the shared configuration for both Server and Client.
 type Config struct {
 	// Log is the centralized logger function.
-	// If nil, logging is disabled.
+	// Entries are rendered as: [LEVEL] msg key=value ...
+	// Ignored when Logger is set. If both are nil, logging is disabled.
 	Log func(args ...any)
+
+	// Logger receives structured, leveled entries (see Log* event constants).
+	Logger Logger
+
+	// LogLevel is the minimum level emitted. Default: LevelDebug (everything).
+	LogLevel LogLevel
 }
@@ -0,0 +1,49 @@
+package sse
+
+import "time"
+
+// Disconnect reasons reported to ServerConfig.OnDisconnect and in sse.disconnect logs.
+const (
+	DisconnectClientGone   = "client gone"      // write to the client failed
+	DisconnectServerClosed = "closed by server" // the hub closed the connection
+	DisconnectEvicted      = "evicted"          // replaced by a newer connection (LimitEvictOldest)
+)
+
+// ConnectionInfo describes an open SSE connection.
+type ConnectionInfo struct {
+	// ID is the random, server-assigned connection identifier.
+	ID string
+	// Key is the member key from IdentityProvider, or ID when not provided.
+	Key string
+	// Meta is the metadata from IdentityProvider.
+	Meta []byte
+	// Channels are the channels resolved by the ChannelProvider.
+	Channels []string
+	// ConnectedAt is when the stream was opened.
+	ConnectedAt time.Time
+}
+
+// Control events are sent by the server without an ID and handled by the
+// client itself; they are not counted as delivered nor passed to OnDeliver.
+const (
+	// ConnectedEvent opens every stream; its data is the connection ID.
+	ConnectedEvent = "sse.connected"
+	// EvictedEvent is sent to a connection right before it is evicted by
+	// LimitEvictOldest. The client stops reconnecting when it receives it.
+	EvictedEvent = "sse.evicted"
+	// ReplyEvent carries the reply to a call made through CallHandler.
+	ReplyEvent = "sse.reply"
+)
+
+// HeaderEventID is the response header carrying the ID assigned to an HTTP publish.
+const HeaderEventID = "X-SSE-Id"
+
+// HTTP request headers read by the server handlers.
+const (
+	HeaderConnection      = "X-SSE-Connection" // connection ID of the sender's stream
+	HeaderPublishEvent    = "X-SSE-Event"      // event name of a raw body
+	HeaderPublishChannels = "X-SSE-Channels"   // comma-separated channels of a raw body
+	HeaderCall            = "X-SSE-Call"       // correlation ID of a call
+	HeaderIdempotencyKey  = "Idempotency-Key"  // PublishOptions.IdempotencyKey of an HTTP publish
+	HeaderProbe           = "X-SSE-Probe"      // asks the stream endpoint whether it would accept, without connecting
+)
@@ -0,0 +1,117 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"sort"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// publishTargeted delivers a direct (PublishOptions.Connection) or anycast
+// message. Such messages reach a single connection, so they are not kept in
+// history, state, inbox or reliable tracking, and PublishRateLimits do not
+// apply. An anycast message skips subscribers whose queue is full. Returns
+// ErrNoRecipient when no connection is open, or ErrQueueFull when none of
+// them could take it.
+func (s *SSEServer) publishTargeted(bMsg *broadcastMessage, opts PublishOptions) error {
+	h := s.hub
+	var err error
+	h.do(func() {
+		var candidates []*clientConnection
+		key := ""
+		if opts.Connection != "" {
+			if client := h.conns[opts.Connection]; client != nil {
+				candidates = append(candidates, client)
+			}
+		} else {
+			candidates, key = h.anycastCandidates(bMsg, opts.Anycast)
+		}
+		if len(candidates) == 0 {
+			err = ErrNoRecipient
+			return
+		}
+
+		bMsg.msg.Id = h.nextID()
+		h.setExpiry(bMsg)
+		out := newOutbound(bMsg.msg)
+		out.conflationKey = bMsg.conflationKey
+		out.expiresAt = bMsg.expiresAt
+		for _, client := range candidates {
+			if !h.push(client, out, false) {
+				continue
+			}
+			if key != "" {
+				h.setAnycastCursor(key, client)
+			}
+			h.metrics.Add(MetricMessagesPublished, 1)
+			if h.config.OnPublish != nil {
+				h.config.OnPublish(bMsg.msg, bMsg.channels)
+			}
+			return
+		}
+		h.tinySSE.log(LevelWarn, LogSlowClient, "conn", candidates[0].id, "channels", bMsg.channels, "id", bMsg.msg.Id)
+		h.metrics.Add(MetricMessagesDropped, 1)
+		err = ErrQueueFull
+	})
+	return err
+}
+
+// anycastCandidates returns the subscribers of bMsg's channels (or target)
+// in the order they should be tried, and the key of their rotation cursor.
+// Must run on the hub goroutine.
+func (h *hub) anycastCandidates(bMsg *broadcastMessage, mode AnycastMode) ([]*clientConnection, string) {
+	var candidates []*clientConnection
+	for client := range h.clients {
+		if h.receives(client, bMsg.route) {
+			candidates = append(candidates, client)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ""
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return connectedBefore(candidates[i], candidates[j])
+	})
+
+	// The cursor rotates per channel set so that every target list is
+	// served fairly on its own: start after the connection picked last.
+	key := JoinSlice(bMsg.channels, ",")
+	if bMsg.target != nil {
+		key = bMsg.target.String()
+	}
+	start := 0
+	if last := h.anycastNext[key]; last != nil {
+		start = sort.Search(len(candidates), func(i int) bool {
+			return connectedBefore(last, candidates[i])
+		})
+	}
+	candidates = append(candidates[start:], candidates[:start]...)
+	if mode == AnycastLeastLoaded {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].queue.len() < candidates[j].queue.len()
+		})
+	}
+	return candidates, key
+}
+
+// setAnycastCursor records client as picked last for key. Cursors are
+// dropped with the connection they point to (see hub.remove).
+func (h *hub) setAnycastCursor(key string, client *clientConnection) {
+	if last := h.anycastNext[key]; last != nil {
+		delete(last.anycastKeys, key)
+	}
+	h.anycastNext[key] = client
+	if client.anycastKeys == nil {
+		client.anycastKeys = make(map[string]bool)
+	}
+	client.anycastKeys[key] = true
+}
+
+// connectedBefore orders connections by connection time, then ID.
+func connectedBefore(a, b *clientConnection) bool {
+	if !a.connectedAt.Equal(b.connectedAt) {
+		return a.connectedAt.Before(b.connectedAt)
+	}
+	return a.id < b.id
+}
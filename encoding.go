@@ -0,0 +1,96 @@
+package sse
+
+// PayloadEncoding selects how SSEMessage.Data is carried on the wire.
+// EventSource parsers split data on \n and \r and require UTF-8, so raw
+// binary payloads must be encoded.
+type PayloadEncoding uint8
+
+const (
+	// EncodingDefault sends raw data in ServerConfig, and inherits
+	// ServerConfig.PayloadEncoding in PublishOptions.
+	EncodingDefault PayloadEncoding = iota
+	// EncodingRaw sends data as-is.
+	EncodingRaw
+	// EncodingAuto base64-encodes only payloads that are not SSE-safe text.
+	EncodingAuto
+	// EncodingBase64 always uses standard base64.
+	EncodingBase64
+	// EncodingBase64URL always uses unpadded base64url.
+	EncodingBase64URL
+)
+
+// Encoding markers prefixed to encoded payloads. They start with \x01,
+// which SSE-safe text never does, so text and encoded data cannot be confused.
+// A raw payload that itself starts with \x01 is sent behind MarkerRaw.
+const (
+	MarkerBase64    = "\x01b64:"
+	MarkerBase64URL = "\x01b64u:"
+	MarkerRaw       = "\x01:"
+)
+
+// DecodePayload reverses EncodePayload. Data without a marker is returned
+// unchanged; so is data whose encoded part is malformed.
+// It is kept free of encoding/base64 for the size of the WASM client.
+func DecodePayload(data []byte) []byte {
+	switch {
+	case hasMarker(data, MarkerRaw):
+		return data[len(MarkerRaw):]
+	case hasMarker(data, MarkerBase64):
+		if out, ok := decodeBase64(data[len(MarkerBase64):], false); ok {
+			return out
+		}
+	case hasMarker(data, MarkerBase64URL):
+		if out, ok := decodeBase64(data[len(MarkerBase64URL):], true); ok {
+			return out
+		}
+	}
+	return data
+}
+
+// decodeBase64 decodes padded standard base64, or unpadded base64url when
+// url is set.
+func decodeBase64(src []byte, url bool) ([]byte, bool) {
+	n := len(src)
+	if !url {
+		if n%4 != 0 {
+			return nil, false
+		}
+		for i := 0; i < 2 && n > 0 && src[n-1] == '='; i++ {
+			n--
+		}
+	}
+	if n%4 == 1 {
+		return nil, false
+	}
+
+	out := make([]byte, 0, n*3/4)
+	var acc uint32
+	bits := 0
+	for _, c := range src[:n] {
+		var v byte
+		switch {
+		case c >= 'A' && c <= 'Z':
+			v = c - 'A'
+		case c >= 'a' && c <= 'z':
+			v = c - 'a' + 26
+		case c >= '0' && c <= '9':
+			v = c - '0' + 52
+		case c == '+' && !url, c == '-' && url:
+			v = 62
+		case c == '/' && !url, c == '_' && url:
+			v = 63
+		default:
+			return nil, false
+		}
+		acc = acc<<6 | uint32(v)
+		if bits += 6; bits >= 8 {
+			bits -= 8
+			out = append(out, byte(acc>>bits))
+		}
+	}
+	return out, true
+}
+
+func hasMarker(data []byte, marker string) bool {
+	return len(data) >= len(marker) && string(data[:len(marker)]) == marker
+}
@@ -0,0 +1,49 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"encoding/base64"
+	"unicode/utf8"
+)
+
+// EncodePayload returns data as it is sent on the wire for enc.
+func EncodePayload(data []byte, enc PayloadEncoding) []byte {
+	switch enc {
+	case EncodingAuto:
+		if isSSEText(data) {
+			return data
+		}
+		return encodeWith(MarkerBase64, base64.StdEncoding, data)
+	case EncodingBase64:
+		return encodeWith(MarkerBase64, base64.StdEncoding, data)
+	case EncodingBase64URL:
+		return encodeWith(MarkerBase64URL, base64.RawURLEncoding, data)
+	}
+	if len(data) > 0 && data[0] == MarkerRaw[0] {
+		// Would be taken for a marker by DecodePayload.
+		return append([]byte(MarkerRaw), data...)
+	}
+	return data
+}
+
+func encodeWith(marker string, enc *base64.Encoding, data []byte) []byte {
+	out := make([]byte, len(marker)+enc.EncodedLen(len(data)))
+	copy(out, marker)
+	enc.Encode(out[len(marker):], data)
+	return out
+}
+
+// isSSEText reports whether data survives an EventSource round trip:
+// valid UTF-8 without \r or other control characters except \n and \t.
+func isSSEText(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+	for _, c := range data {
+		if c < 0x20 && c != '\n' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
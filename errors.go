@@ -0,0 +1,120 @@
+package sse
+
+import . "github.com/tinywasm/fmt"
+
+// ErrorKind classifies an SSEError.
+type ErrorKind uint8
+
+const (
+	ErrorConnection   ErrorKind = iota // network failure; the client retries
+	ErrorUnauthorized                  // 401: credentials missing or invalid
+	ErrorForbidden                     // 403: authenticated but not allowed
+	ErrorRateLimited                   // 429: retry after RetryAfter seconds
+	ErrorGone                          // 410: do not reconnect
+	ErrorServer                        // 5xx: server misconfiguration or failure
+	ErrorMaxRetries                    // client gave up after MaxReconnectAttempts
+	ErrorEvicted                       // replaced by a newer connection; do not reconnect
+	ErrorTimeout                       // a call got no reply within its timeout
+	ErrorCanceled                      // a call was canceled before its reply
+)
+
+// ErrorHeader carries the ErrorKind name on rejected SSE responses,
+// so the client can classify a rejection without parsing the body.
+const ErrorHeader = "X-SSE-Error"
+
+var errorKindNames = []string{"connection", "unauthorized", "forbidden", "rate_limited", "gone", "server", "max_retries", "evicted", "timeout", "canceled"}
+
+func (k ErrorKind) String() string {
+	if int(k) < len(errorKindNames) {
+		return errorKindNames[k]
+	}
+	return "unknown"
+}
+
+// parseErrorKind returns the ErrorKind named s, falling back to the HTTP status.
+func parseErrorKind(s string, status int) ErrorKind {
+	for i, name := range errorKindNames {
+		if name == s {
+			return ErrorKind(i)
+		}
+	}
+	switch {
+	case status == 401:
+		return ErrorUnauthorized
+	case status == 403:
+		return ErrorForbidden
+	case status == 429:
+		return ErrorRateLimited
+	case status == 204 || status == 410:
+		return ErrorGone
+	case status >= 500:
+		return ErrorServer
+	}
+	return ErrorConnection
+}
+
+// SSEError is a typed SSE error.
+//
+// On the server, a ChannelProvider returns one (see Unauthorized, Forbidden,
+// RateLimited, Gone) to control the rejection status code, headers and body.
+// On the client, OnError receives one so the kind can be distinguished.
+type SSEError struct {
+	Kind    ErrorKind
+	Status  int    // HTTP status code, 0 when not applicable
+	Message string // human readable detail, sent as the response body
+	// RetryAfter is the number of seconds to wait before reconnecting.
+	// Sent as the Retry-After header. 0 = not set.
+	RetryAfter int
+}
+
+func (e *SSEError) Error() string {
+	msg := "SSE " + e.Kind.String()
+	if e.Status != 0 {
+		msg += " (" + Convert(e.Status).String() + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// httpStatus returns Status, or the status matching Kind when Status is 0
+// (e.g. a hand-built &SSEError{Kind: ErrorForbidden}), else fallback.
+func (e *SSEError) httpStatus(fallback int) int {
+	if e.Status != 0 {
+		return e.Status
+	}
+	switch e.Kind {
+	case ErrorUnauthorized:
+		return 401
+	case ErrorForbidden:
+		return 403
+	case ErrorRateLimited:
+		return 429
+	case ErrorGone:
+		return 410
+	case ErrorServer:
+		return 500
+	}
+	return fallback
+}
+
+// Unauthorized rejects a connection with 401.
+func Unauthorized(message string) *SSEError {
+	return &SSEError{Kind: ErrorUnauthorized, Status: 401, Message: message}
+}
+
+// Forbidden rejects a connection with 403.
+func Forbidden(message string) *SSEError {
+	return &SSEError{Kind: ErrorForbidden, Status: 403, Message: message}
+}
+
+// RateLimited rejects a connection with 429 and a Retry-After hint in seconds.
+func RateLimited(message string, retryAfter int) *SSEError {
+	return &SSEError{Kind: ErrorRateLimited, Status: 429, Message: message, RetryAfter: retryAfter}
+}
+
+// Gone rejects a connection with 410, telling the client not to reconnect.
+func Gone(message string) *SSEError {
+	return &SSEError{Kind: ErrorGone, Status: 410, Message: message}
+}
@@ -0,0 +1,61 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"errors"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/json"
+	"github.com/tinywasm/model"
+	"github.com/tinywasm/router"
+)
+
+// jsonError encodes {"error":"..."}.
+type jsonError struct{ message string }
+
+func (e *jsonError) IsNil() bool { return e == nil }
+
+func (e *jsonError) EncodeFields(w model.FieldWriter) { w.String("error", e.message) }
+
+func writeJSON(ctx router.Context, status int, v model.Encodable) {
+	var body []byte
+	if err := json.Encode(v, &body); err != nil {
+		ctx.WriteStatus(500)
+		return
+	}
+	ctx.SetHeader("Content-Type", "application/json")
+	ctx.WriteStatus(status)
+	ctx.Write(body) //nolint:errcheck
+}
+
+func writeError(ctx router.Context, status int, message string) {
+	writeJSON(ctx, status, &jsonError{message: message})
+}
+
+// writeFailure answers err, with its status when it is an *SSEError.
+func writeFailure(ctx router.Context, err error, status int) {
+	var sseErr *SSEError
+	if errors.As(err, &sseErr) {
+		status = sseErr.httpStatus(status)
+		if sseErr.RetryAfter > 0 {
+			ctx.SetHeader("Retry-After", Convert(sseErr.RetryAfter).String())
+		}
+		writeError(ctx, status, sseErr.Message)
+		return
+	}
+	writeError(ctx, status, err.Error())
+}
+
+// readJSON decodes the request body into v, answering 400 on failure.
+func readJSON(ctx router.Context, v model.Decodable) bool {
+	body, err := ctx.Body()
+	if err == nil {
+		err = json.Decode(body, v)
+	}
+	if err != nil {
+		writeError(ctx, 400, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
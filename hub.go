@@ -5,6 +5,7 @@ package sse
 import (
 	"bytes"
 	"sync"
+	"time"
 
 	. "github.com/tinywasm/fmt"
 )
@@ -13,10 +14,17 @@ import (
 type hub struct {
 	tinySSE *tinySSE
 	config  *ServerConfig
+	metrics Metrics
 
 	// Registered clients.
 	clients map[*clientConnection]bool
 
+	// Registered clients by connection ID.
+	conns map[string]*clientConnection
+
+	// Registered clients by identity key, oldest first.
+	byKey map[string][]*clientConnection
+
 	// Inbound messages from the clients.
 	broadcast chan *broadcastMessage
 
@@ -26,44 +34,184 @@ type hub struct {
 	// Unregister requests from clients.
 	unregister chan *clientConnection
 
+	// exec runs closures on the hub goroutine (queries and timers).
+	exec chan func()
+
+	// Presence members per tracked channel, keyed by member key.
+	presence map[string]map[string]*presenceMember
+
+	// Subscriber count per channel.
+	subscribers map[string]int
+
+	// Last message per state key, per state channel.
+	state map[string]map[string]*historyItem
+
+	// Last publish to, or departure of the last subscriber from, each
+	// state channel (see StateRetention).
+	stateActive map[string]time.Time
+
+	// Unacknowledged messages per identity key (ReliableChannels).
+	reliable map[string]*reliableMember
+
+	// Stored messages of inbox channels without subscribers; nil when
+	// ServerConfig.InboxChannels is empty.
+	inbox      InboxStore
+	inboxQueue *inboxQueue // runs the inbox calls off the hub goroutine
+
+	// Connection picked last per anycast channel set.
+	anycastNext map[string]*clientConnection
+
+	// Whether the expiry sweeper runs; started by the first expiring message.
+	sweeping bool
+
+	// Closed by stop to end the sweepers.
+	done     chan struct{}
+	stopOnce sync.Once
+
 	// History buffer
 	history      []*historyItem
+	historyFloor string // newest ID pushed out by HistoryReplayBuffer; "" = none
 	historyMutex sync.RWMutex
-	lastID       int
+	lastID       int // see newHub
 }
 
 type registerRequest struct {
 	client      *clientConnection
 	lastEventID string
+	admitted    chan *SSEError // nil error = registered
 }
 
 type broadcastMessage struct {
-	msg      *SSEMessage
-	channels []string
+	msg *SSEMessage
+	route
+	key           string // state key; defaults to msg.Event
+	conflationKey string
+	expiresAt     time.Time   // zero = never
+	assigned      chan string // receives the ID once dispatched (PublishWithID); nil = nobody waits
+	counted       bool        // RateThrottle: held part of a message already counted as published
 }
 
 type historyItem struct {
-	msg      *SSEMessage
-	channels []string
+	msg *SSEMessage
+	route
+	expiresAt time.Time
+}
+
+// route selects the connections receiving a message.
+type route struct {
+	channels  []string
+	target    channelExpr // PublishOptions.Target; replaces channels when set
+	origin    string      // PublishOptions.Origin: connection skipped
+	originKey string      // PublishOptions.OriginKey: identity skipped
+	except    []string    // subscribers of these already got the message (RateThrottle)
 }
 
 // clientConnection represents a connected SSE client on the server side.
 type clientConnection struct {
+	id          string
+	key         string // identity key from IdentityProvider; defaults to id
+	meta        []byte
+	connectedAt time.Time
+	queue       *sendQueue
+	closeReason string // set by the hub before closing queue; empty = DisconnectServerClosed
+
+	// Hub goroutine only: while inbox reads are pending, messages for the
+	// connection are collected here instead of queued (see finishCatchUp).
+	catchUp    *catchUp
+	inboxReads int
+
+	anycastKeys map[string]bool // hub goroutine only: cursors pointing here
+	reliable    bool            // hub goroutine only: counted by reliableJoin
+
+	// channels is only written on the hub goroutine, under mu.
+	// Other goroutines read it through channelList.
 	channels []string
-	send     chan []byte
+	mu       sync.RWMutex
+}
+
+// outbound is a queued message ready to be written to a connection.
+type outbound struct {
+	msg           *SSEMessage
+	data          []byte // formatted SSE frame, shared by all recipients
+	conflationKey string
+	control       bool      // control event: not counted as delivered
+	expiresAt     time.Time // dropped instead of written after this; zero = never
+	written       func()    // called once written to the connection; nil = none
+}
+
+func newOutbound(msg *SSEMessage) *outbound {
+	return &outbound{msg: msg, data: []byte(formatSSEMessage(msg.Id, msg.Event, msg.Data))}
+}
+
+// newControl returns a control event (see ConnectedEvent).
+func newControl(event, data string) *outbound {
+	out := newOutbound(&SSEMessage{Event: event, Data: []byte(data)})
+	out.control = true
+	return out
+}
+
+func (c *clientConnection) info() ConnectionInfo {
+	return ConnectionInfo{
+		ID:          c.id,
+		Key:         c.key,
+		Meta:        c.meta,
+		Channels:    c.channelList(),
+		ConnectedAt: c.connectedAt,
+	}
+}
+
+// channelList returns the connection's channels; safe off the hub goroutine.
+func (c *clientConnection) channelList() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.channels
 }
 
 func newHub(t *tinySSE, c *ServerConfig) *hub {
+	var m Metrics = nopMetrics{}
+	if c.Metrics != nil {
+		m = c.Metrics
+	}
 	h := &hub{
 		tinySSE:    t,
 		config:     c,
+		metrics:    m,
 		broadcast:  make(chan *broadcastMessage),
 		register:   make(chan registerRequest),
 		unregister: make(chan *clientConnection),
+		exec:       make(chan func()),
 		clients:    make(map[*clientConnection]bool),
-		history:    make([]*historyItem, 0, c.HistoryReplayBuffer),
+		conns:      make(map[string]*clientConnection),
+		byKey:      make(map[string][]*clientConnection),
+		presence:   make(map[string]map[string]*presenceMember),
+
+		subscribers: make(map[string]int),
+		state:       make(map[string]map[string]*historyItem),
+		stateActive: make(map[string]time.Time),
+		reliable:    make(map[string]*reliableMember),
+		anycastNext: make(map[string]*clientConnection),
+		history:     make([]*historyItem, 0, c.HistoryReplayBuffer),
+		done:        make(chan struct{}),
+
+		// IDs count on from the start time in microseconds, so a restarted
+		// server never reuses an ID a client, history or store has already
+		// seen, and Last-Event-IDs of the previous process stay ordered.
+		lastID: int(time.Now().UnixMicro()),
+	}
+	if len(c.InboxChannels) > 0 {
+		h.inbox = c.InboxStore
+		if h.inbox == nil {
+			h.inbox = NewMemoryInbox()
+		}
+		h.inboxQueue = newInboxQueue()
 	}
 	go h.run()
+	if len(c.ReliableChannels) > 0 {
+		go h.runReliableSweeper()
+	}
+	if h.inbox != nil {
+		go h.runInboxSweeper()
+	}
 	return h
 }
 
@@ -71,37 +219,258 @@ func (h *hub) run() {
 	for {
 		select {
 		case req := <-h.register:
+			if err := h.admit(req.client); err != nil {
+				req.admitted <- err
+				continue
+			}
 			h.clients[req.client] = true
-			h.replayHistory(req.client, req.lastEventID)
+			h.conns[req.client.id] = req.client
+			h.byKey[req.client.key] = append(h.byKey[req.client.key], req.client)
+			h.trackSubscribers(req.client.channels, 1)
+			cu := newCatchUp()
+			h.replayHistory(req.client, req.lastEventID, cu)
+			h.reliableJoin(req.client, cu)
+			h.finishCatchUp(req.client, req.client.channels, cu)
+			// After the catch-up: the join event's ID is newer than all of it.
+			h.presenceJoin(req.client, req.client.channels)
+			req.admitted <- nil
 
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-			}
+			h.remove(client, "")
 
 		case bMsg := <-h.broadcast:
-			// 1. Assign ID
-			bMsg.msg.Id = h.nextID()
-
-			// 2. Add to history
-			h.addToHistory(bMsg.msg, bMsg.channels)
-
-			// 3. Format message once
-			formattedMsg := formatSSEMessage(bMsg.msg.Id, bMsg.msg.Event, bMsg.msg.Data)
-			dataBytes := []byte(formattedMsg)
-
-			// 4. Send to interested clients
-			for client := range h.clients {
-				if h.isSubscribed(client, bMsg.channels) {
-					select {
-					case client.send <- dataBytes:
-					default:
-						h.tinySSE.log("Dropping message for slow client")
-					}
-				}
+			h.dispatch(bMsg)
+
+		case fn := <-h.exec:
+			fn()
+		}
+	}
+}
+
+// remove unregisters client and closes its queue; reason is reported by its
+// handler (empty = DisconnectServerClosed). Must run on the hub goroutine.
+func (h *hub) remove(client *clientConnection, reason string) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	delete(h.conns, client.id)
+
+	same := h.byKey[client.key]
+	for i, c := range same {
+		if c == client {
+			same = append(same[:i:i], same[i+1:]...)
+			break
+		}
+	}
+	if len(same) == 0 {
+		delete(h.byKey, client.key)
+	} else {
+		h.byKey[client.key] = same
+	}
+
+	client.closeReason = reason
+	client.queue.close()
+	h.trackSubscribers(client.channels, -1)
+	h.presenceLeave(client, client.channels)
+	h.reliableLeave(client)
+	for key := range client.anycastKeys {
+		delete(h.anycastNext, key)
+	}
+}
+
+// tick runs fn on the hub goroutine every interval until stop is called.
+func (h *hub) tick(interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+		}
+		select {
+		case <-h.done:
+			return
+		case h.exec <- fn:
+		}
+	}
+}
+
+// stop ends the sweepers started with tick. Streams and publishing go on.
+func (h *hub) stop() {
+	h.stopOnce.Do(func() { close(h.done) })
+}
+
+// do runs fn on the hub goroutine and waits for it to return.
+func (h *hub) do(fn func()) {
+	done := make(chan struct{})
+	h.exec <- func() {
+		fn()
+		close(done)
+	}
+	<-done
+}
+
+// dispatch assigns an ID, stores and fans out a message.
+// Must run on the hub goroutine.
+func (h *hub) dispatch(bMsg *broadcastMessage) {
+	// 1. Assign ID and expiry
+	bMsg.msg.Id = h.nextID()
+	if !bMsg.counted {
+		h.metrics.Add(MetricMessagesPublished, 1)
+	}
+	h.setExpiry(bMsg)
+	if bMsg.assigned != nil {
+		bMsg.assigned <- bMsg.msg.Id
+	}
+
+	// 2. Add to history and state cache
+	h.addToHistory(bMsg)
+	h.cacheState(bMsg)
+	h.trackReliable(bMsg)
+	h.storeInbox(bMsg)
+
+	if h.config.OnPublish != nil {
+		h.config.OnPublish(bMsg.msg, bMsg.channels)
+	}
+
+	// 3. Format message once
+	out := newOutbound(bMsg.msg)
+	out.conflationKey = bMsg.conflationKey
+	out.expiresAt = bMsg.expiresAt
+
+	// 4. Send to interested clients
+	for client := range h.clients {
+		if h.receives(client, bMsg.route) {
+			h.enqueue(client, out)
+		}
+	}
+}
+
+// enqueue queues out for client without blocking. A pending message with the
+// same conflation key is replaced; otherwise a full queue drops out.
+// Must run on the hub goroutine.
+func (h *hub) enqueue(client *clientConnection, out *outbound) {
+	if !h.push(client, out, false) {
+		h.tinySSE.log(LevelWarn, LogSlowClient, "conn", client.id, "channels", client.channels, "id", out.msg.Id)
+		h.metrics.Add(MetricMessagesDropped, 1)
+	}
+}
+
+// push queues out to client and reports whether there was room; force
+// queues it even when full. While a catch-up is pending, out joins it so it
+// is queued in ID order. Must run on the hub goroutine.
+func (h *hub) push(client *clientConnection, out *outbound, force bool) bool {
+	if client.catchUp != nil {
+		client.catchUp.add(out, force)
+		return true
+	}
+	conflated, ok := client.queue.push(out, force)
+	if conflated {
+		h.metrics.Add(MetricMessagesConflated, 1)
+	}
+	return ok
+}
+
+// subscribe adds channels to a connection and sends their cached state.
+// Returns false if the connection is unknown.
+func (h *hub) subscribe(connID string, channels []string) bool {
+	found := false
+	h.do(func() {
+		client := h.conns[connID]
+		if client == nil {
+			return
+		}
+		found = true
+
+		var added []string
+		for _, ch := range channels {
+			if !containsString(client.channels, ch) && !containsString(added, ch) {
+				added = append(added, ch)
+			}
+		}
+		if len(added) == 0 {
+			return
+		}
+
+		client.mu.Lock()
+		client.channels = append(append([]string(nil), client.channels...), added...)
+		client.mu.Unlock()
+
+		h.trackSubscribers(added, 1)
+		cu := newCatchUp()
+		h.collectState(cu, added, "", false)
+		h.reliableJoin(client, cu)
+		h.finishCatchUp(client, added, cu)
+		h.presenceJoin(client, added)
+	})
+	return found
+}
+
+// unsubscribe removes channels from a connection.
+// Returns false if the connection is unknown.
+func (h *hub) unsubscribe(connID string, channels []string) bool {
+	found := false
+	h.do(func() {
+		client := h.conns[connID]
+		if client == nil {
+			return
+		}
+		found = true
+
+		var kept, removed []string
+		for _, ch := range client.channels {
+			if containsString(channels, ch) {
+				removed = append(removed, ch)
+			} else {
+				kept = append(kept, ch)
 			}
 		}
+		if len(removed) == 0 {
+			return
+		}
+
+		client.mu.Lock()
+		client.channels = kept
+		client.mu.Unlock()
+
+		h.trackSubscribers(removed, -1)
+		h.presenceLeave(client, removed)
+		h.reliableUnsubscribe(client, removed)
+	})
+	return found
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// trackSubscribers updates connection and per-channel subscriber gauges by delta.
+// Must run on the hub goroutine.
+func (h *hub) trackSubscribers(channels []string, delta int) {
+	h.metrics.Set(MetricClientsConnected, float64(len(h.clients)))
+	for _, ch := range channels {
+		n := h.subscribers[ch] + delta
+		if n > 0 {
+			h.subscribers[ch] = n
+			h.metrics.Set(MetricChannelSubscribers, float64(n), "channel", ch)
+			continue
+		}
+		delete(h.subscribers, ch)
+		if _, ok := h.state[ch]; ok {
+			h.stateActive[ch] = time.Now()
+		}
+		if d, ok := h.metrics.(MetricsDeleter); ok {
+			d.Delete(MetricChannelSubscribers, "channel", ch)
+		} else {
+			h.metrics.Set(MetricChannelSubscribers, 0, "channel", ch)
+		}
 	}
 }
 
@@ -110,66 +479,111 @@ func (h *hub) nextID() string {
 	return Convert(h.lastID).String()
 }
 
-func (h *hub) addToHistory(msg *SSEMessage, channels []string) {
+func (h *hub) addToHistory(bMsg *broadcastMessage) {
 	if h.config.HistoryReplayBuffer <= 0 {
 		return
 	}
 	h.historyMutex.Lock()
 	defer h.historyMutex.Unlock()
 
-	item := &historyItem{
-		msg:      msg,
-		channels: channels,
-	}
+	item := &historyItem{msg: bMsg.msg, route: bMsg.route, expiresAt: bMsg.expiresAt}
 
 	h.history = append(h.history, item)
 	if len(h.history) > h.config.HistoryReplayBuffer {
+		h.historyFloor = h.history[0].msg.Id
 		h.history = h.history[1:] // Remove oldest
 	}
+	h.metrics.Set(MetricHistorySize, float64(len(h.history)))
 }
 
-func (h *hub) replayHistory(client *clientConnection, lastEventID string) {
+// replayHistory adds missed history and cached state for a new client to cu.
+func (h *hub) replayHistory(client *clientConnection, lastEventID string, cu *catchUp) {
+	replay := h.historySince(client, lastEventID)
+	for _, item := range replay {
+		cu.add(item.outbound(), true)
+	}
+	h.collectState(cu, client.channels, lastEventID, true)
+
+	if len(replay) > 0 {
+		h.metrics.Add(MetricMessagesReplayed, float64(len(replay)))
+		h.tinySSE.log(LevelDebug, LogReplay, "conn", client.id, "last_event_id", lastEventID, "count", len(replay))
+	}
+}
+
+// historySince returns the unexpired history items client should replay.
+func (h *hub) historySince(client *clientConnection, lastEventID string) []*historyItem {
 	if h.config.HistoryReplayBuffer <= 0 {
-		return
+		return nil
 	}
 
 	// No Last-Event-ID: replay all history if ReplayAllOnConnect is enabled
-	if lastEventID == "" {
-		if !h.config.ReplayAllOnConnect {
-			return
-		}
-		h.historyMutex.RLock()
-		defer h.historyMutex.RUnlock()
-		for _, item := range h.history {
-			if h.isSubscribed(client, item.channels) {
-				formattedMsg := formatSSEMessage(item.msg.Id, item.msg.Event, item.msg.Data)
-				client.send <- []byte(formattedMsg)
-			}
-		}
-		return
+	if lastEventID == "" && !h.config.ReplayAllOnConnect {
+		return nil
 	}
 
 	h.historyMutex.RLock()
 	defer h.historyMutex.RUnlock()
 
-	// Find where to start (after the last known event ID)
-	startIndex := -1
-	for i, item := range h.history {
-		if item.msg.Id == lastEventID {
-			startIndex = i + 1
-			break
+	startIndex := 0
+	if lastEventID != "" {
+		// Find where to start (after the last known event ID)
+		startIndex = -1
+		for i, item := range h.history {
+			if item.msg.Id == lastEventID {
+				startIndex = i + 1
+				break
+			}
+		}
+		if startIndex == -1 {
+			return h.historyAfter(client, lastEventID)
 		}
 	}
 
-	if startIndex != -1 && startIndex < len(h.history) {
-		for i := startIndex; i < len(h.history); i++ {
-			item := h.history[i]
-			if h.isSubscribed(client, item.channels) {
-				formattedMsg := formatSSEMessage(item.msg.Id, item.msg.Event, item.msg.Data)
-				client.send <- []byte(formattedMsg)
-			}
+	now := time.Now()
+	var out []*historyItem
+	for i := startIndex; i < len(h.history); i++ {
+		item := h.history[i]
+		if h.receives(client, item.route) && !expired(item.expiresAt, now) {
+			out = append(out, item)
 		}
 	}
+	return out
+}
+
+// historyAfter returns the unexpired history items with IDs after
+// lastEventID, for an ID no longer in history because it expired or was not
+// kept (direct messages, a previous server). Nothing is replayed when
+// messages after it were pushed out by HistoryReplayBuffer: the gap could not
+// be filled. Must be called with historyMutex held.
+func (h *hub) historyAfter(client *clientConnection, lastEventID string) []*historyItem {
+	if _, err := Convert(lastEventID).Int64(); err != nil {
+		return nil
+	}
+	if h.historyFloor != "" && idAfter(h.historyFloor, lastEventID) {
+		return nil
+	}
+	now := time.Now()
+	var out []*historyItem
+	for _, item := range h.history {
+		if idAfter(item.msg.Id, lastEventID) && h.receives(client, item.route) && !expired(item.expiresAt, now) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// receives reports whether client gets a message routed by r.
+func (h *hub) receives(client *clientConnection, r route) bool {
+	if client.id == r.origin || (r.originKey != "" && client.key == r.originKey) {
+		return false
+	}
+	if len(r.except) > 0 && h.isSubscribed(client, r.except) {
+		return false
+	}
+	if r.target != nil {
+		return r.target.match(client.channels)
+	}
+	return h.isSubscribed(client, r.channels)
 }
 
 func (h *hub) isSubscribed(client *clientConnection, messageChannels []string) bool {
@@ -187,26 +601,51 @@ func (h *hub) isSubscribed(client *clientConnection, messageChannels []string) b
 	return false
 }
 
+// formatSSEMessage renders an SSE frame. Data is split on every line break
+// EventSource knows (\r\n, \n, \r), so it cannot start a field of its own.
+// Line breaks in id or event are rejected before (see validEvent); here they
+// are blanked as a last guard.
 func formatSSEMessage(id, event string, data []byte) string {
 	var b bytes.Buffer
-	b.WriteString("id: ")
-	b.WriteString(id)
-	b.WriteString("\n")
+	if id != "" {
+		b.WriteString("id: ")
+		b.WriteString(singleLine(id))
+		b.WriteString("\n")
+	}
 
 	if event != "" {
 		b.WriteString("event: ")
-		b.WriteString(event)
+		b.WriteString(singleLine(event))
 		b.WriteString("\n")
 	}
 
-	lines := bytes.Split(data, []byte("\n"))
-	for _, line := range lines {
-		line = bytes.TrimSuffix(line, []byte("\r"))
+	for {
+		i := bytes.IndexAny(data, "\r\n")
+		if i < 0 {
+			break
+		}
 		b.WriteString("data: ")
-		b.Write(line)
+		b.Write(data[:i])
 		b.WriteString("\n")
+		if data[i] == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			i++
+		}
+		data = data[i+1:]
 	}
-
-	b.WriteString("\n")
+	b.WriteString("data: ")
+	b.Write(data)
+	b.WriteString("\n\n")
 	return b.String()
 }
+
+// validEvent reports whether event fits on its SSE field line.
+func validEvent(event string) bool {
+	return !Contains(event, "\n") && !Contains(event, "\r")
+}
+
+func singleLine(s string) string {
+	if validEvent(s) {
+		return s
+	}
+	return ReplaceAll(ReplaceAll(s, "\r", " "), "\n", " ")
+}
@@ -0,0 +1,97 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultIdempotencyWindow is used when ServerConfig.IdempotencyWindow is 0.
+const defaultIdempotencyWindow = 5 * time.Minute
+
+// idempotency remembers recent PublishOptions.IdempotencyKey values and the
+// outcome of their publish, so that retries are not sent again and get the
+// same answer.
+type idempotency struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*idempotentPublish
+	order   []*idempotentPublish // by time, for expiry
+}
+
+type idempotentPublish struct {
+	key string
+	at  time.Time
+
+	// Outcome of the first publish, set before done is closed.
+	id   string // empty = nothing was sent right away
+	held bool   // held back by RateThrottle, sent later
+	err  error  // e.g. RateLimited for some of the channels
+
+	done chan struct{} // closed once the first publish returned
+}
+
+func newIdempotency(window time.Duration) *idempotency {
+	if window <= 0 {
+		window = defaultIdempotencyWindow
+	}
+	return &idempotency{window: window, entries: make(map[string]*idempotentPublish)}
+}
+
+// publish calls send unless key was published within the window. A
+// duplicate waits for the first publish and returns its ID and error; when
+// that one sent nothing and holds nothing back, the duplicate tries again.
+func (d *idempotency) publish(key string, send func() (string, bool, error)) (id string, duplicate bool, err error) {
+	for {
+		d.mu.Lock()
+		now := time.Now()
+		d.expire(now)
+		if p := d.entries[key]; p != nil {
+			d.mu.Unlock()
+			<-p.done
+			if p.sent() {
+				return p.id, true, p.err
+			}
+			continue
+		}
+		p := &idempotentPublish{key: key, at: now, done: make(chan struct{})}
+		d.entries[key] = p
+		d.order = append(d.order, p)
+		d.mu.Unlock()
+
+		var held bool
+		id, held, err = send()
+
+		d.mu.Lock()
+		p.id, p.held, p.err = id, held, err
+		if !p.sent() && d.entries[key] == p {
+			delete(d.entries, key)
+		}
+		d.mu.Unlock()
+		close(p.done)
+		return id, false, err
+	}
+}
+
+// sent reports whether the publish reached or will reach anyone.
+func (p *idempotentPublish) sent() bool {
+	return p.id != "" || p.held
+}
+
+// expire forgets keys older than the window. Must be called with mu held.
+func (d *idempotency) expire(now time.Time) {
+	n := 0
+	for n < len(d.order) && now.Sub(d.order[n].at) >= d.window {
+		p := d.order[n]
+		if d.entries[p.key] == p {
+			delete(d.entries, p.key)
+		}
+		n++
+	}
+	if n > 0 {
+		clear(d.order[:n])
+		d.order = d.order[n:]
+	}
+}
@@ -0,0 +1,251 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults of the inbox settings.
+const (
+	defaultInboxMaxMessages = 100
+	defaultInboxTTL         = 24 * time.Hour
+	maxInboxSweepInterval   = time.Minute
+)
+
+// storeInbox keeps bMsg for its inbox channels that have no subscriber.
+// The store is written on the inbox goroutine. Must run on the hub goroutine.
+func (h *hub) storeInbox(bMsg *broadcastMessage) {
+	if h.inbox == nil {
+		return
+	}
+	limit := h.config.InboxMaxMessages
+	if limit <= 0 {
+		limit = defaultInboxMaxMessages
+	}
+	expiresAt := time.Now().Add(h.inboxTTL())
+	if !bMsg.expiresAt.IsZero() && bMsg.expiresAt.Before(expiresAt) {
+		expiresAt = bMsg.expiresAt
+	}
+
+	for _, ch := range bMsg.channels {
+		if h.subscribers[ch] > 0 || !matchAnyChannel(h.config.InboxChannels, ch) {
+			continue
+		}
+		h.inboxQueue.do(func() {
+			dropped, err := h.inbox.Append(ch, bMsg.msg, expiresAt, limit)
+			if err != nil {
+				h.tinySSE.log(LevelError, LogInbox, "channel", ch, "id", bMsg.msg.Id, "error", err)
+				return
+			}
+			h.metrics.Add(MetricInboxStored, 1)
+			if dropped > 0 {
+				h.metrics.Add(MetricInboxDropped, float64(dropped))
+			}
+		})
+	}
+}
+
+// readInbox reads the stored messages of client's inbox channels. It runs on
+// the inbox goroutine and returns the step adding them to a catch-up, which
+// must run on the hub goroutine. A message is removed from the store once
+// written to a connection, so one lost with a failed write is kept; one
+// collected already (another channel, the replay) is removed once that copy is.
+func (h *hub) readInbox(client *clientConnection, channels []string) func(cu *catchUp) {
+	now := time.Now()
+	stored := make(map[string][]*SSEMessage, len(channels))
+	for _, ch := range channels {
+		msgs, err := h.inbox.Pending(ch, now)
+		if err != nil {
+			h.tinySSE.log(LevelError, LogInbox, "conn", client.id, "channel", ch, "error", err)
+			continue
+		}
+		stored[ch] = msgs
+	}
+
+	return func(cu *catchUp) {
+		for _, ch := range channels {
+			count := 0
+			for _, msg := range stored[ch] {
+				out := newOutbound(msg)
+				out.written = h.inboxRemover(ch, msg.Id)
+				if cu.add(out, true) {
+					count++
+				}
+			}
+			if count > 0 {
+				h.metrics.Add(MetricInboxDelivered, float64(count))
+				h.tinySSE.log(LevelDebug, LogInbox, "conn", client.id, "channel", ch, "count", count)
+			}
+		}
+	}
+}
+
+// inboxRemover returns the callback removing message id from channel's inbox.
+func (h *hub) inboxRemover(channel, id string) func() {
+	return func() {
+		h.inboxQueue.do(func() {
+			if err := h.inbox.Remove(channel, []string{id}); err != nil {
+				h.tinySSE.log(LevelError, LogInbox, "channel", channel, "id", id, "error", err)
+			}
+		})
+	}
+}
+
+func (h *hub) inboxTTL() time.Duration {
+	if h.config.InboxTTL > 0 {
+		return h.config.InboxTTL
+	}
+	return defaultInboxTTL
+}
+
+// runInboxSweeper removes expired inbox messages until the hub stops, so
+// channels nobody reconnects to do not keep them forever.
+func (h *hub) runInboxSweeper() {
+	interval := h.inboxTTL() / 2
+	if interval > maxInboxSweepInterval {
+		interval = maxInboxSweepInterval
+	}
+	h.tick(interval, func() {
+		now := time.Now()
+		h.inboxQueue.do(func() {
+			if err := h.inbox.Expire(now); err != nil {
+				h.tinySSE.log(LevelError, LogInbox, "error", err)
+			}
+		})
+	})
+}
+
+// inboxQueue runs InboxStore calls one at a time and in order on its own
+// goroutine, so a slow store never holds up the hub.
+type inboxQueue struct {
+	mu   sync.Mutex
+	jobs []func()
+	wake chan struct{}
+}
+
+func newInboxQueue() *inboxQueue {
+	q := &inboxQueue{wake: make(chan struct{}, 1)}
+	go q.run()
+	return q
+}
+
+// do queues fn without blocking.
+func (q *inboxQueue) do(fn func()) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, fn)
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *inboxQueue) run() {
+	for range q.wake {
+		q.mu.Lock()
+		jobs := q.jobs
+		q.jobs = nil
+		q.mu.Unlock()
+		for _, fn := range jobs {
+			fn()
+		}
+	}
+}
+
+// MemoryInbox is an in-memory InboxStore. Stored messages do not survive a
+// restart; implement InboxStore on a database for that.
+type MemoryInbox struct {
+	mu       sync.Mutex
+	channels map[string][]inboxEntry
+}
+
+type inboxEntry struct {
+	msg       *SSEMessage
+	expiresAt time.Time
+}
+
+// NewMemoryInbox returns an empty in-memory inbox.
+func NewMemoryInbox() *MemoryInbox {
+	return &MemoryInbox{channels: make(map[string][]inboxEntry)}
+}
+
+// Append implements InboxStore.
+func (m *MemoryInbox) Append(channel string, msg *SSEMessage, expiresAt time.Time, limit int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := append(m.channels[channel], inboxEntry{msg: msg, expiresAt: expiresAt})
+	dropped := 0
+	if limit > 0 && len(entries) > limit {
+		dropped = len(entries) - limit
+		entries = append([]inboxEntry(nil), entries[dropped:]...)
+	}
+	m.channels[channel] = entries
+	return dropped, nil
+}
+
+// Pending implements InboxStore.
+func (m *MemoryInbox) Pending(channel string, now time.Time) ([]*SSEMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []*SSEMessage
+	for _, e := range m.channels[channel] {
+		if now.Before(e.expiresAt) {
+			out = append(out, e.msg)
+		}
+	}
+	return out, nil
+}
+
+// Remove implements InboxStore.
+func (m *MemoryInbox) Remove(channel string, ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := m.channels[channel]
+	kept := entries[:0]
+	for _, e := range entries {
+		if !containsString(ids, e.msg.Id) {
+			kept = append(kept, e)
+		}
+	}
+	if len(kept) == 0 {
+		delete(m.channels, channel)
+	} else {
+		clear(entries[len(kept):])
+		m.channels[channel] = kept
+	}
+	return nil
+}
+
+// Expire implements InboxStore.
+func (m *MemoryInbox) Expire(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for channel, entries := range m.channels {
+		kept := entries[:0]
+		for _, e := range entries {
+			if now.Before(e.expiresAt) {
+				kept = append(kept, e)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.channels, channel)
+		} else {
+			clear(entries[len(kept):])
+			m.channels[channel] = kept
+		}
+	}
+	return nil
+}
+
+// Len returns the number of messages stored for channel, expired or not.
+func (m *MemoryInbox) Len(channel string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.channels[channel])
+}
@@ -1,6 +1,10 @@
 package sse
 
-import "github.com/tinywasm/router"
+import (
+	"time"
+
+	"github.com/tinywasm/router"
+)
 
 // ChannelProvider resolves SSE channels for a connection.
 // Implemented by external packages (e.g., crudp session handler).
@@ -13,10 +17,21 @@ type ChannelProvider interface {
 	//
 	// Returns:
 	//   - channels: List of channels to subscribe (e.g., ["all", "user:123", "role:admin"])
-	//   - err: If non-nil, connection is rejected with 401/403
+	//   - err: If non-nil, connection is rejected. Return an *SSEError
+	//     (Unauthorized, Forbidden, RateLimited, Gone) to control the status
+	//     code, Retry-After header and body; any other error maps to 401.
 	ResolveChannels(ctx router.Context) (channels []string, err error)
 }
 
+// IdentityProvider is an optional interface a ChannelProvider may implement
+// to identify the member behind a connection.
+type IdentityProvider interface {
+	// ResolveIdentity returns a stable member key (e.g. "user:123") and optional
+	// metadata exposed through presence. Called once when client connects,
+	// after ResolveChannels succeeded. An empty key falls back to the connection ID.
+	ResolveIdentity(ctx router.Context) (key string, meta []byte)
+}
+
 // SSEPublisher allows publishing messages to SSE clients.
 // Implemented by sse.SSEServer.
 type SSEPublisher interface {
@@ -27,3 +42,65 @@ type SSEPublisher interface {
 	// PublishEvent sends data with an event type for client-side routing.
 	PublishEvent(event string, data []byte, channels ...string)
 }
+
+// Metrics receives server telemetry. Labels are alternating key/value pairs,
+// e.g. Set(MetricChannelSubscribers, 3, "channel", "all").
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Add increments a counter by delta.
+	Add(name string, delta float64, labels ...string)
+	// Set sets a gauge to value.
+	Set(name string, value float64, labels ...string)
+	// Observe records one sample, e.g. a latency in seconds.
+	Observe(name string, value float64, labels ...string)
+}
+
+// MetricsDeleter is implemented by Metrics that can drop a labeled series.
+// The server deletes the subscriber gauge of a channel once it is empty, so
+// per-user channels do not pile up series.
+type MetricsDeleter interface {
+	Delete(name string, labels ...string)
+}
+
+// PublishAuthorizer authorizes publishes received by SSEServer.PublishHandler.
+type PublishAuthorizer interface {
+	// AuthorizePublish returns nil to accept a publish of event to channels.
+	// Return an *SSEError (Unauthorized, Forbidden, RateLimited) to control
+	// the status code; any other error maps to 403. For a JSON body it is
+	// first called with an empty event and nil channels, before the body is
+	// read, then again with the parsed ones.
+	AuthorizePublish(ctx router.Context, event string, channels []string) error
+}
+
+// InboxStore persists messages for channels without subscribers
+// (ServerConfig.InboxChannels). Its methods are called one at a time on a
+// goroutine of their own, never blocking publishes; messages are delivered
+// at least once. Implementations must be safe for concurrent use.
+type InboxStore interface {
+	// Append stores msg for channel until expiresAt, keeping at most limit
+	// messages for channel by dropping the oldest. Returns how many were dropped.
+	Append(channel string, msg *SSEMessage, expiresAt time.Time, limit int) (dropped int, err error)
+
+	// Pending returns the messages stored for channel that are not expired
+	// at now, oldest first, without removing them.
+	Pending(channel string, now time.Time) ([]*SSEMessage, error)
+
+	// Remove deletes the messages ids of channel, once they were written to
+	// a connection. Unknown ids are ignored.
+	Remove(channel string, ids []string) error
+
+	// Expire removes every message expired at now.
+	Expire(now time.Time) error
+}
+
+// ScheduleStore persists scheduled publishes (SSEServer.PublishAt) so they
+// survive a restart: the server loads them on creation and fires those due
+// while it was down right away. Implementations must be safe for concurrent use.
+type ScheduleStore interface {
+	// Save stores a scheduled publish.
+	Save(p *ScheduledPublish) error
+	// Delete removes the scheduled publish id once it fired or was canceled.
+	Delete(id string) error
+	// Load returns every stored scheduled publish.
+	Load() ([]*ScheduledPublish, error)
+}
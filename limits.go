@@ -0,0 +1,62 @@
+//go:build !wasm
+
+package sse
+
+// admit enforces the connection limits for client, evicting older connections
+// of the same key under LimitEvictOldest. Must run on the hub goroutine.
+func (h *hub) admit(client *clientConnection) *SSEError {
+	evict, err := h.checkLimits(client)
+	if err != nil {
+		return err
+	}
+	for _, old := range append([]*clientConnection(nil), evict...) {
+		old.queue.push(newControl(EvictedEvent, client.id), true)
+		h.remove(old, DisconnectEvicted)
+		h.tinySSE.log(LevelInfo, LogEvicted, "conn", old.id, "key", old.key, "by", client.id)
+	}
+	return nil
+}
+
+// checkLimits returns the connections that admitting client would evict, or
+// the limit it exceeds. Changes nothing. Must run on the hub goroutine.
+func (h *hub) checkLimits(client *clientConnection) ([]*clientConnection, *SSEError) {
+	c := h.config
+
+	var evict []*clientConnection
+	if c.MaxConnectionsPerKey > 0 {
+		same := h.byKey[client.key]
+		if over := len(same) - c.MaxConnectionsPerKey + 1; over > 0 {
+			if c.LimitPolicy != LimitEvictOldest {
+				return nil, h.limitError("too many connections for " + client.key)
+			}
+			evict = same[:over]
+		}
+	}
+
+	if c.MaxConnections > 0 && len(h.clients)-len(evict) >= c.MaxConnections {
+		return nil, h.limitError("too many connections")
+	}
+
+	if c.MaxConnectionsPerChannel > 0 {
+		for _, ch := range client.channels {
+			n := h.subscribers[ch]
+			for _, old := range evict {
+				if containsString(old.channels, ch) {
+					n--
+				}
+			}
+			if n >= c.MaxConnectionsPerChannel {
+				return nil, h.limitError("too many connections to " + ch)
+			}
+		}
+	}
+	return evict, nil
+}
+
+func (h *hub) limitError(message string) *SSEError {
+	retry := h.config.LimitRetryAfter
+	if retry <= 0 {
+		retry = 5
+	}
+	return RateLimited(message, retry)
+}
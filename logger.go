@@ -0,0 +1,79 @@
+package sse
+
+import . "github.com/tinywasm/fmt"
+
+// LogLevel is the severity of a log entry.
+type LogLevel uint8
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// Lifecycle events logged by the server. Every entry carries "conn" (the
+// connection ID) and "channels" when a connection is involved.
+const (
+	LogConnect     = "sse.connect"     // stream opened; fields: conn, key, channels
+	LogDisconnect  = "sse.disconnect"  // stream closed; fields: conn, channels, reason[, error]
+	LogRejected    = "sse.rejected"    // connection refused; fields: status, error
+	LogReplay      = "sse.replay"      // history replayed; fields: conn, last_event_id, count
+	LogSlowClient  = "sse.slow"        // message dropped; fields: conn, channels, id (key, dropped for reliable delivery)
+	LogEvicted     = "sse.evicted"     // connection evicted by a limit; fields: conn, key, by
+	LogThrottled   = "sse.throttled"   // connection attempt over AdmissionRate; fields: retry_ms
+	LogRateLimited = "sse.ratelimited" // publish over PublishRateLimits; fields: channel, policy, action
+	LogRedeliver   = "sse.redeliver"   // unacknowledged messages sent again; fields: key, conn, count or id
+	LogInbox       = "sse.inbox"       // inbox delivered or failed; fields: conn, channel, count or error
+	LogDuplicate   = "sse.duplicate"   // publish suppressed by its idempotency key; fields: key, id
+	LogConfig      = "sse.config"      // setting without effect; fields: setting, error
+	LogSchedule    = "sse.schedule"    // scheduled publish or its store failed; fields: op, id, event, error
+	LogPublish     = "sse.publish"     // HTTP publish rejected; fields: event, channels, error
+	LogReceive     = "sse.receive"     // upstream message rejected by OnReceive; fields: conn, event, error
+	LogCall        = "sse.call"        // call rejected by OnCall; fields: conn, method, call, error
+	LogPresence    = "sse.presence"    // presence event not sent; fields: channel, error
+	LogAdmin       = "sse.admin"       // admin request rejected; fields: path, error
+	LogCompression = "sse.compression" // compression disabled; fields: error
+)
+
+// Logger is a structured, leveled logger.
+// fields are alternating key/value pairs, e.g. ("conn", id, "channels", chans).
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...any)
+}
+
+// funcLogger adapts Config.Log to Logger, rendering fields as key=value.
+type funcLogger func(args ...any)
+
+func (f funcLogger) Log(level LogLevel, msg string, fields ...any) {
+	args := make([]any, 0, 2+len(fields)/2)
+	args = append(args, "["+level.String()+"]", msg)
+	for i := 0; i+1 < len(fields); i += 2 {
+		args = append(args, Convert(fields[i]).String()+"="+formatLogValue(fields[i+1]))
+	}
+	f(args...)
+}
+
+func formatLogValue(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []string:
+		return "[" + JoinSlice(v, ",") + "]"
+	case error:
+		return v.Error()
+	}
+	return Convert(v).String()
+}
@@ -0,0 +1,223 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// Metric names reported by the server.
+const (
+	MetricClientsConnected     = "sse_clients_connected"           // gauge
+	MetricChannelSubscribers   = "sse_channel_subscribers"         // gauge, label "channel"
+	MetricMessagesPublished    = "sse_messages_published_total"    // counter
+	MetricMessagesDelivered    = "sse_messages_delivered_total"    // counter
+	MetricMessagesDropped      = "sse_messages_dropped_total"      // counter
+	MetricMessagesReplayed     = "sse_messages_replayed_total"     // counter
+	MetricMessagesConflated    = "sse_messages_conflated_total"    // counter
+	MetricHistorySize          = "sse_history_size"                // gauge
+	MetricWriteSeconds         = "sse_write_duration_seconds"      // observation
+	MetricConnectionsQueued    = "sse_connections_queued_total"    // counter
+	MetricConnectionsThrottled = "sse_connections_throttled_total" // counter
+	MetricMessagesRateLimited  = "sse_messages_rate_limited_total" // counter, labels "channel", "action"
+	MetricMessagesReceived     = "sse_messages_received_total"     // counter
+	MetricMessagesPending      = "sse_messages_pending"            // gauge, unacknowledged reliable messages
+	MetricMessagesRedelivered  = "sse_messages_redelivered_total"  // counter
+	MetricCallsReceived        = "sse_calls_received_total"        // counter
+	MetricCallsReplied         = "sse_calls_replied_total"         // counter, label "result" ("ok" or the error kind)
+	MetricInboxStored          = "sse_inbox_stored_total"          // counter
+	MetricInboxDelivered       = "sse_inbox_delivered_total"       // counter
+	MetricInboxDropped         = "sse_inbox_dropped_total"         // counter, over InboxMaxMessages
+	MetricMessagesExpired      = "sse_messages_expired_total"      // counter, label "where" ("queue" or "history")
+	MetricScheduledPending     = "sse_scheduled_pending"           // gauge, publishes waiting for their time
+	MetricMessagesDuplicate    = "sse_messages_duplicate_total"    // counter, publishes suppressed by IdempotencyKey
+)
+
+// nopMetrics is used when ServerConfig.Metrics is nil.
+type nopMetrics struct{}
+
+func (nopMetrics) Add(string, float64, ...string)     {}
+func (nopMetrics) Set(string, float64, ...string)     {}
+func (nopMetrics) Observe(string, float64, ...string) {}
+
+type metricKind uint8
+
+const (
+	metricCounter metricKind = iota
+	metricGauge
+	metricSummary
+)
+
+type metricSeries struct {
+	labels string // pre-rendered `{k="v",...}`, empty when unlabeled
+	value  float64
+	count  uint64 // summaries only
+}
+
+type metricFamily struct {
+	kind   metricKind
+	series map[string]*metricSeries
+}
+
+// MetricsRegistry is an in-memory Metrics implementation that exposes its
+// values in the Prometheus text format.
+type MetricsRegistry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+}
+
+// NewMetricsRegistry creates an empty MetricsRegistry.
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{families: make(map[string]*metricFamily)}
+}
+
+// Add implements Metrics.Add.
+func (r *MetricsRegistry) Add(name string, delta float64, labels ...string) {
+	r.mu.Lock()
+	r.series(name, metricCounter, labels).value += delta
+	r.mu.Unlock()
+}
+
+// Set implements Metrics.Set.
+func (r *MetricsRegistry) Set(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	r.series(name, metricGauge, labels).value = value
+	r.mu.Unlock()
+}
+
+// Observe implements Metrics.Observe. Samples are exported as a summary
+// (name_sum and name_count).
+func (r *MetricsRegistry) Observe(name string, value float64, labels ...string) {
+	r.mu.Lock()
+	s := r.series(name, metricSummary, labels)
+	s.value += value
+	s.count++
+	r.mu.Unlock()
+}
+
+// Value returns the current value of a counter or gauge (the sum for summaries).
+func (r *MetricsRegistry) Value(name string, labels ...string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.families[name]
+	if f == nil {
+		return 0
+	}
+	if s := f.series[renderLabels(labels)]; s != nil {
+		return s.value
+	}
+	return 0
+}
+
+// Delete implements MetricsDeleter.
+func (r *MetricsRegistry) Delete(name string, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f := r.families[name]; f != nil {
+		delete(f.series, renderLabels(labels))
+	}
+}
+
+func (r *MetricsRegistry) series(name string, kind metricKind, labels []string) *metricSeries {
+	f := r.families[name]
+	if f == nil {
+		f = &metricFamily{kind: kind, series: make(map[string]*metricSeries)}
+		r.families[name] = f
+	}
+	key := renderLabels(labels)
+	s := f.series[key]
+	if s == nil {
+		s = &metricSeries{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+// WriteText renders all metrics in the Prometheus text exposition format.
+func (r *MetricsRegistry) WriteText() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b []byte
+	for _, name := range names {
+		f := r.families[name]
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b = append(b, "# TYPE "+name+" "+f.kind.String()+"\n"...)
+		for _, k := range keys {
+			s := f.series[k]
+			if f.kind == metricSummary {
+				b = appendSample(b, name+"_sum", s.labels, s.value)
+				b = appendSample(b, name+"_count", s.labels, float64(s.count))
+				continue
+			}
+			b = appendSample(b, name, s.labels, s.value)
+		}
+	}
+	return b
+}
+
+// Handler returns a handler serving WriteText.
+// Register it with: r.Get("/metrics", registry.Handler())
+func (r *MetricsRegistry) Handler() func(ctx router.Context) {
+	return func(ctx router.Context) {
+		ctx.SetHeader("Content-Type", "text/plain; version=0.0.4")
+		ctx.WriteStatus(200)
+		ctx.Write(r.WriteText()) //nolint:errcheck
+	}
+}
+
+func (k metricKind) String() string {
+	switch k {
+	case metricGauge:
+		return "gauge"
+	case metricSummary:
+		return "summary"
+	}
+	return "counter"
+}
+
+func appendSample(b []byte, name, labels string, v float64) []byte {
+	b = append(b, name...)
+	b = append(b, labels...)
+	b = append(b, ' ')
+	if v == math.Trunc(v) && math.Abs(v) < 1e18 {
+		b = append(b, Convert(int64(v)).String()...) // counts stay exact
+	} else {
+		b = append(b, Convert(v).String()...)
+	}
+	return append(b, '\n')
+}
+
+// renderLabels formats key/value pairs as `{k="v",...}`. A trailing odd key is ignored.
+func renderLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	b := []byte{'{'}
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		v := ReplaceAll(labels[i+1], `\`, `\\`)
+		v = ReplaceAll(v, `"`, `\"`)
+		v = ReplaceAll(v, "\n", `\n`)
+		b = append(b, labels[i]+`="`+v+`"`...)
+	}
+	return string(append(b, '}'))
+}
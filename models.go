@@ -10,3 +10,80 @@ var SSEMessageModel = model.Definition{
 		{Name: "data", Type: model.Blob()},
 	},
 }
+
+var PresenceMemberModel = model.Definition{
+	Name: "presencemember",
+	Fields: []model.Field{
+		{Name: "key", Type: model.Text()},
+		{Name: "meta", Type: model.Blob()},
+		{Name: "connections", Type: model.Int()},
+	},
+}
+
+var AdminConnectionModel = model.Definition{
+	Name: "adminconnection",
+	Fields: []model.Field{
+		{Name: "id", Type: model.Text()},
+		{Name: "key", Type: model.Text()},
+		{Name: "meta", Type: model.Blob()},
+		{Name: "channels", Type: model.Text()},
+		{Name: "connected_at", Type: model.Int()},
+	},
+}
+
+var AdminChannelModel = model.Definition{
+	Name: "adminchannel",
+	Fields: []model.Field{
+		{Name: "name", Type: model.Text()},
+		{Name: "subscribers", Type: model.Int()},
+	},
+}
+
+var AdminStatsModel = model.Definition{
+	Name: "adminstats",
+	Fields: []model.Field{
+		{Name: "connections", Type: model.Int()},
+		{Name: "channels", Type: model.Int()},
+		{Name: "history", Type: model.Int()},
+		{Name: "last_id", Type: model.Text()},
+		{Name: "frames", Type: model.Int()},
+		{Name: "bytes", Type: model.Int()},
+	},
+}
+
+var PublishRequestModel = model.Definition{
+	Name: "publishrequest",
+	Fields: []model.Field{
+		{Name: "event", Type: model.Text()},
+		{Name: "channels", Type: model.Text()},
+		{Name: "data", Type: model.Text()},
+	},
+}
+
+var AdminDisconnectModel = model.Definition{
+	Name: "admindisconnect",
+	Fields: []model.Field{
+		{Name: "id", Type: model.Text()},
+	},
+}
+
+var ScheduledPublishModel = model.Definition{
+	Name: "scheduledpublish",
+	Fields: []model.Field{
+		{Name: "id", Type: model.Text()},
+		{Name: "at", Type: model.Int()},
+		{Name: "event", Type: model.Text()},
+		{Name: "channels", Type: model.Text()},
+		{Name: "target", Type: model.Text()},
+		{Name: "key", Type: model.Text()},
+		{Name: "ttl", Type: model.Int()},
+		{Name: "conflation_key", Type: model.Text()},
+		{Name: "idempotency_key", Type: model.Text()},
+		{Name: "encoding", Type: model.Int()},
+		{Name: "origin", Type: model.Text()},
+		{Name: "origin_key", Type: model.Text()},
+		{Name: "connection", Type: model.Text()},
+		{Name: "anycast", Type: model.Int()},
+		{Name: "data", Type: model.Blob()},
+	},
+}
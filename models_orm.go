@@ -47,3 +47,338 @@ func (m *SSEMessage) Validate(action byte) error {
 	return model.ValidateFields(action, m)
 }
 
+
+type PresenceMember struct {
+	Key string
+	Meta []byte
+	Connections int64
+}
+
+func (m *PresenceMember) ModelName() string { return "presencemember" }
+
+func (m *PresenceMember) Schema() []model.Field { return PresenceMemberModel.Fields }
+
+func (m *PresenceMember) Pointers() []any { return []any{&m.Key, &m.Meta, &m.Connections} }
+
+func (m *PresenceMember) IsNil() bool { return m == nil }
+
+func (m *PresenceMember) EncodeFields(w model.FieldWriter) {
+	w.String("key", m.Key)
+	w.Bytes("meta", m.Meta)
+	w.Int("connections", m.Connections)
+}
+
+func (m *PresenceMember) DecodeFields(r model.FieldReader) {
+	if v, ok := r.String("key"); ok { m.Key = v }
+	if v, ok := r.Bytes("meta"); ok { m.Meta = v }
+	if v, ok := r.Int("connections"); ok { m.Connections = v }
+}
+
+type PresenceMemberList []*PresenceMember
+
+func (s *PresenceMemberList) Schema() []model.Field { return nil }
+func (s *PresenceMemberList) Pointers() []any     { return nil }
+func (s *PresenceMemberList) Len() int             { return len(*s) }
+func (s *PresenceMemberList) At(i int) model.Fielder { return (*s)[i] }
+func (s *PresenceMemberList) Append() model.Fielder  { v := &PresenceMember{}; *s = append(*s, v); return v }
+func (s *PresenceMemberList) IsNil() bool          { return s == nil }
+func (s *PresenceMemberList) EncodeFields(_ model.FieldWriter) {}
+func (s *PresenceMemberList) DecodeFields(_ model.FieldReader) {}
+
+func (m *PresenceMember) Validate(action byte) error {
+	return model.ValidateFields(action, m)
+}
+
+
+type AdminConnection struct {
+	Id string
+	Key string
+	Meta []byte
+	Channels string
+	ConnectedAt int64
+}
+
+func (m *AdminConnection) ModelName() string { return "adminconnection" }
+
+func (m *AdminConnection) Schema() []model.Field { return AdminConnectionModel.Fields }
+
+func (m *AdminConnection) Pointers() []any { return []any{&m.Id, &m.Key, &m.Meta, &m.Channels, &m.ConnectedAt} }
+
+func (m *AdminConnection) IsNil() bool { return m == nil }
+
+func (m *AdminConnection) EncodeFields(w model.FieldWriter) {
+	w.String("id", m.Id)
+	w.String("key", m.Key)
+	w.Bytes("meta", m.Meta)
+	w.String("channels", m.Channels)
+	w.Int("connected_at", m.ConnectedAt)
+}
+
+func (m *AdminConnection) DecodeFields(r model.FieldReader) {
+	if v, ok := r.String("id"); ok { m.Id = v }
+	if v, ok := r.String("key"); ok { m.Key = v }
+	if v, ok := r.Bytes("meta"); ok { m.Meta = v }
+	if v, ok := r.String("channels"); ok { m.Channels = v }
+	if v, ok := r.Int("connected_at"); ok { m.ConnectedAt = v }
+}
+
+type AdminConnectionList []*AdminConnection
+
+func (s *AdminConnectionList) Schema() []model.Field { return nil }
+func (s *AdminConnectionList) Pointers() []any     { return nil }
+func (s *AdminConnectionList) Len() int             { return len(*s) }
+func (s *AdminConnectionList) At(i int) model.Fielder { return (*s)[i] }
+func (s *AdminConnectionList) Append() model.Fielder  { v := &AdminConnection{}; *s = append(*s, v); return v }
+func (s *AdminConnectionList) IsNil() bool          { return s == nil }
+func (s *AdminConnectionList) EncodeFields(_ model.FieldWriter) {}
+func (s *AdminConnectionList) DecodeFields(_ model.FieldReader) {}
+
+func (m *AdminConnection) Validate(action byte) error {
+	return model.ValidateFields(action, m)
+}
+
+
+type AdminChannel struct {
+	Name string
+	Subscribers int64
+}
+
+func (m *AdminChannel) ModelName() string { return "adminchannel" }
+
+func (m *AdminChannel) Schema() []model.Field { return AdminChannelModel.Fields }
+
+func (m *AdminChannel) Pointers() []any { return []any{&m.Name, &m.Subscribers} }
+
+func (m *AdminChannel) IsNil() bool { return m == nil }
+
+func (m *AdminChannel) EncodeFields(w model.FieldWriter) {
+	w.String("name", m.Name)
+	w.Int("subscribers", m.Subscribers)
+}
+
+func (m *AdminChannel) DecodeFields(r model.FieldReader) {
+	if v, ok := r.String("name"); ok { m.Name = v }
+	if v, ok := r.Int("subscribers"); ok { m.Subscribers = v }
+}
+
+type AdminChannelList []*AdminChannel
+
+func (s *AdminChannelList) Schema() []model.Field { return nil }
+func (s *AdminChannelList) Pointers() []any     { return nil }
+func (s *AdminChannelList) Len() int             { return len(*s) }
+func (s *AdminChannelList) At(i int) model.Fielder { return (*s)[i] }
+func (s *AdminChannelList) Append() model.Fielder  { v := &AdminChannel{}; *s = append(*s, v); return v }
+func (s *AdminChannelList) IsNil() bool          { return s == nil }
+func (s *AdminChannelList) EncodeFields(_ model.FieldWriter) {}
+func (s *AdminChannelList) DecodeFields(_ model.FieldReader) {}
+
+func (m *AdminChannel) Validate(action byte) error {
+	return model.ValidateFields(action, m)
+}
+
+
+type AdminStats struct {
+	Connections int64
+	Channels int64
+	History int64
+	LastId string
+	Frames int64
+	Bytes int64
+}
+
+func (m *AdminStats) ModelName() string { return "adminstats" }
+
+func (m *AdminStats) Schema() []model.Field { return AdminStatsModel.Fields }
+
+func (m *AdminStats) Pointers() []any { return []any{&m.Connections, &m.Channels, &m.History, &m.LastId, &m.Frames, &m.Bytes} }
+
+func (m *AdminStats) IsNil() bool { return m == nil }
+
+func (m *AdminStats) EncodeFields(w model.FieldWriter) {
+	w.Int("connections", m.Connections)
+	w.Int("channels", m.Channels)
+	w.Int("history", m.History)
+	w.String("last_id", m.LastId)
+	w.Int("frames", m.Frames)
+	w.Int("bytes", m.Bytes)
+}
+
+func (m *AdminStats) DecodeFields(r model.FieldReader) {
+	if v, ok := r.Int("connections"); ok { m.Connections = v }
+	if v, ok := r.Int("channels"); ok { m.Channels = v }
+	if v, ok := r.Int("history"); ok { m.History = v }
+	if v, ok := r.String("last_id"); ok { m.LastId = v }
+	if v, ok := r.Int("frames"); ok { m.Frames = v }
+	if v, ok := r.Int("bytes"); ok { m.Bytes = v }
+}
+
+type AdminStatsList []*AdminStats
+
+func (s *AdminStatsList) Schema() []model.Field { return nil }
+func (s *AdminStatsList) Pointers() []any     { return nil }
+func (s *AdminStatsList) Len() int             { return len(*s) }
+func (s *AdminStatsList) At(i int) model.Fielder { return (*s)[i] }
+func (s *AdminStatsList) Append() model.Fielder  { v := &AdminStats{}; *s = append(*s, v); return v }
+func (s *AdminStatsList) IsNil() bool          { return s == nil }
+func (s *AdminStatsList) EncodeFields(_ model.FieldWriter) {}
+func (s *AdminStatsList) DecodeFields(_ model.FieldReader) {}
+
+func (m *AdminStats) Validate(action byte) error {
+	return model.ValidateFields(action, m)
+}
+
+
+type PublishRequest struct {
+	Event string
+	Channels string
+	Data string
+}
+
+func (m *PublishRequest) ModelName() string { return "publishrequest" }
+
+func (m *PublishRequest) Schema() []model.Field { return PublishRequestModel.Fields }
+
+func (m *PublishRequest) Pointers() []any { return []any{&m.Event, &m.Channels, &m.Data} }
+
+func (m *PublishRequest) IsNil() bool { return m == nil }
+
+func (m *PublishRequest) EncodeFields(w model.FieldWriter) {
+	w.String("event", m.Event)
+	w.String("channels", m.Channels)
+	w.String("data", m.Data)
+}
+
+func (m *PublishRequest) DecodeFields(r model.FieldReader) {
+	if v, ok := r.String("event"); ok { m.Event = v }
+	if v, ok := r.String("channels"); ok { m.Channels = v }
+	if v, ok := r.String("data"); ok { m.Data = v }
+}
+
+type PublishRequestList []*PublishRequest
+
+func (s *PublishRequestList) Schema() []model.Field { return nil }
+func (s *PublishRequestList) Pointers() []any     { return nil }
+func (s *PublishRequestList) Len() int             { return len(*s) }
+func (s *PublishRequestList) At(i int) model.Fielder { return (*s)[i] }
+func (s *PublishRequestList) Append() model.Fielder  { v := &PublishRequest{}; *s = append(*s, v); return v }
+func (s *PublishRequestList) IsNil() bool          { return s == nil }
+func (s *PublishRequestList) EncodeFields(_ model.FieldWriter) {}
+func (s *PublishRequestList) DecodeFields(_ model.FieldReader) {}
+
+func (m *PublishRequest) Validate(action byte) error {
+	return model.ValidateFields(action, m)
+}
+
+
+type AdminDisconnect struct {
+	Id string
+}
+
+func (m *AdminDisconnect) ModelName() string { return "admindisconnect" }
+
+func (m *AdminDisconnect) Schema() []model.Field { return AdminDisconnectModel.Fields }
+
+func (m *AdminDisconnect) Pointers() []any { return []any{&m.Id} }
+
+func (m *AdminDisconnect) IsNil() bool { return m == nil }
+
+func (m *AdminDisconnect) EncodeFields(w model.FieldWriter) {
+	w.String("id", m.Id)
+}
+
+func (m *AdminDisconnect) DecodeFields(r model.FieldReader) {
+	if v, ok := r.String("id"); ok { m.Id = v }
+}
+
+type AdminDisconnectList []*AdminDisconnect
+
+func (s *AdminDisconnectList) Schema() []model.Field { return nil }
+func (s *AdminDisconnectList) Pointers() []any     { return nil }
+func (s *AdminDisconnectList) Len() int             { return len(*s) }
+func (s *AdminDisconnectList) At(i int) model.Fielder { return (*s)[i] }
+func (s *AdminDisconnectList) Append() model.Fielder  { v := &AdminDisconnect{}; *s = append(*s, v); return v }
+func (s *AdminDisconnectList) IsNil() bool          { return s == nil }
+func (s *AdminDisconnectList) EncodeFields(_ model.FieldWriter) {}
+func (s *AdminDisconnectList) DecodeFields(_ model.FieldReader) {}
+
+func (m *AdminDisconnect) Validate(action byte) error {
+	return model.ValidateFields(action, m)
+}
+
+
+type ScheduledPublish struct {
+	Id string
+	At int64
+	Event string
+	Channels string
+	Target string
+	Key string
+	Ttl int64
+	ConflationKey string
+	IdempotencyKey string
+	Encoding int64
+	Origin string
+	OriginKey string
+	Connection string
+	Anycast int64
+	Data []byte
+}
+
+func (m *ScheduledPublish) ModelName() string { return "scheduledpublish" }
+
+func (m *ScheduledPublish) Schema() []model.Field { return ScheduledPublishModel.Fields }
+
+func (m *ScheduledPublish) Pointers() []any { return []any{&m.Id, &m.At, &m.Event, &m.Channels, &m.Target, &m.Key, &m.Ttl, &m.ConflationKey, &m.IdempotencyKey, &m.Encoding, &m.Origin, &m.OriginKey, &m.Connection, &m.Anycast, &m.Data} }
+
+func (m *ScheduledPublish) IsNil() bool { return m == nil }
+
+func (m *ScheduledPublish) EncodeFields(w model.FieldWriter) {
+	w.String("id", m.Id)
+	w.Int("at", m.At)
+	w.String("event", m.Event)
+	w.String("channels", m.Channels)
+	w.String("target", m.Target)
+	w.String("key", m.Key)
+	w.Int("ttl", m.Ttl)
+	w.String("conflation_key", m.ConflationKey)
+	w.String("idempotency_key", m.IdempotencyKey)
+	w.Int("encoding", m.Encoding)
+	w.String("origin", m.Origin)
+	w.String("origin_key", m.OriginKey)
+	w.String("connection", m.Connection)
+	w.Int("anycast", m.Anycast)
+	w.Bytes("data", m.Data)
+}
+
+func (m *ScheduledPublish) DecodeFields(r model.FieldReader) {
+	if v, ok := r.String("id"); ok { m.Id = v }
+	if v, ok := r.Int("at"); ok { m.At = v }
+	if v, ok := r.String("event"); ok { m.Event = v }
+	if v, ok := r.String("channels"); ok { m.Channels = v }
+	if v, ok := r.String("target"); ok { m.Target = v }
+	if v, ok := r.String("key"); ok { m.Key = v }
+	if v, ok := r.Int("ttl"); ok { m.Ttl = v }
+	if v, ok := r.String("conflation_key"); ok { m.ConflationKey = v }
+	if v, ok := r.String("idempotency_key"); ok { m.IdempotencyKey = v }
+	if v, ok := r.Int("encoding"); ok { m.Encoding = v }
+	if v, ok := r.String("origin"); ok { m.Origin = v }
+	if v, ok := r.String("origin_key"); ok { m.OriginKey = v }
+	if v, ok := r.String("connection"); ok { m.Connection = v }
+	if v, ok := r.Int("anycast"); ok { m.Anycast = v }
+	if v, ok := r.Bytes("data"); ok { m.Data = v }
+}
+
+type ScheduledPublishList []*ScheduledPublish
+
+func (s *ScheduledPublishList) Schema() []model.Field { return nil }
+func (s *ScheduledPublishList) Pointers() []any     { return nil }
+func (s *ScheduledPublishList) Len() int             { return len(*s) }
+func (s *ScheduledPublishList) At(i int) model.Fielder { return (*s)[i] }
+func (s *ScheduledPublishList) Append() model.Fielder  { v := &ScheduledPublish{}; *s = append(*s, v); return v }
+func (s *ScheduledPublishList) IsNil() bool          { return s == nil }
+func (s *ScheduledPublishList) EncodeFields(_ model.FieldWriter) {}
+func (s *ScheduledPublishList) DecodeFields(_ model.FieldReader) {}
+
+func (m *ScheduledPublish) Validate(action byte) error {
+	return model.ValidateFields(action, m)
+}
@@ -0,0 +1,148 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/json"
+)
+
+// Presence event names broadcast to a tracked channel when PresenceEvents is enabled.
+const (
+	PresenceJoinEvent  = "presence.join"
+	PresenceLeaveEvent = "presence.leave"
+)
+
+// presenceMember aggregates every connection of one member in one channel.
+type presenceMember struct {
+	key   string
+	meta  []byte
+	conns int
+	leave *time.Timer // pending debounced leave, nil when none
+}
+
+// matchChannel reports whether channel matches pattern.
+// A pattern ending in "*" matches by prefix (e.g. "room:*"); otherwise it must be equal.
+func matchChannel(pattern, channel string) bool {
+	if HasSuffix(pattern, "*") {
+		return HasPrefix(channel, TrimSuffix(pattern, "*"))
+	}
+	return pattern == channel
+}
+
+// matchAnyChannel reports whether channel matches any of patterns.
+func matchAnyChannel(patterns []string, channel string) bool {
+	for _, p := range patterns {
+		if matchChannel(p, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// presenceJoin records client in every tracked channel of channels.
+// Must run on the hub goroutine.
+func (h *hub) presenceJoin(client *clientConnection, channels []string) {
+	for _, ch := range channels {
+		if !matchAnyChannel(h.config.PresenceChannels, ch) {
+			continue
+		}
+		members := h.presence[ch]
+		if members == nil {
+			members = make(map[string]*presenceMember)
+			h.presence[ch] = members
+		}
+
+		m := members[client.key]
+		if m == nil {
+			m = &presenceMember{key: client.key, meta: client.meta}
+			members[client.key] = m
+		}
+		m.conns++
+
+		if m.leave != nil {
+			// Reconnected within the debounce window: the member never left.
+			m.leave.Stop()
+			m.leave = nil
+			continue
+		}
+		if m.conns == 1 {
+			h.publishPresence(PresenceJoinEvent, ch, m)
+		}
+	}
+}
+
+// presenceLeave removes client from every tracked channel of channels.
+// Must run on the hub goroutine.
+func (h *hub) presenceLeave(client *clientConnection, channels []string) {
+	for _, ch := range channels {
+		m := h.presence[ch][client.key]
+		if m == nil {
+			continue
+		}
+		m.conns--
+		if m.conns > 0 {
+			continue
+		}
+
+		if h.config.PresenceDebounce <= 0 {
+			h.removePresence(ch, m)
+			continue
+		}
+
+		var t *time.Timer
+		t = time.AfterFunc(h.config.PresenceDebounce, func() {
+			h.exec <- func() {
+				// Skip if the member came back or a newer leave superseded this one.
+				if m.leave == t && m.conns == 0 {
+					h.removePresence(ch, m)
+				}
+			}
+		})
+		m.leave = t
+	}
+}
+
+func (h *hub) removePresence(channel string, m *presenceMember) {
+	m.leave = nil
+	delete(h.presence[channel], m.key)
+	if len(h.presence[channel]) == 0 {
+		delete(h.presence, channel)
+	}
+	h.publishPresence(PresenceLeaveEvent, channel, m)
+}
+
+func (h *hub) publishPresence(event, channel string, m *presenceMember) {
+	if !h.config.PresenceEvents {
+		return
+	}
+	var data []byte
+	if err := json.Encode(m.snapshot(), &data); err != nil {
+		h.tinySSE.log(LevelError, LogPresence, "channel", channel, "error", err)
+		return
+	}
+	h.dispatch(&broadcastMessage{
+		msg:   &SSEMessage{Event: event, Data: data},
+		route: route{channels: []string{channel}},
+	})
+}
+
+func (m *presenceMember) snapshot() *PresenceMember {
+	return &PresenceMember{Key: m.key, Meta: m.meta, Connections: int64(m.conns)}
+}
+
+// presenceOf returns the members currently present in channel.
+// Members with a pending debounced leave are still reported.
+func (h *hub) presenceOf(channel string) []*PresenceMember {
+	var out []*PresenceMember
+	h.do(func() {
+		for _, m := range h.presence[channel] {
+			out = append(out, m.snapshot())
+		}
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
@@ -0,0 +1,114 @@
+//go:build !wasm
+
+package sse
+
+import (
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// PublishHandler returns a handler that lets external producers (cron jobs,
+// scripts, other services) publish into the hub. The body is either a JSON
+// PublishRequest (Content-Type: application/json, channels comma-separated)
+// or the raw data, with the event and channels in the X-SSE-Event and
+// X-SSE-Channels headers. Every publish is checked with auth before the body
+// is read; a nil auth rejects everything. An Idempotency-Key header suppresses retries (see
+// PublishOptions.IdempotencyKey). Answers 204 once the message is dispatched,
+// with its ID in the X-SSE-Id header.
+// Register it with: r.Post("/sse/publish", server.PublishHandler(auth))
+func (s *SSEServer) PublishHandler(auth PublishAuthorizer) func(ctx router.Context) {
+	return func(ctx router.Context) {
+		if auth == nil {
+			writeError(ctx, 403, "publishing not authorized")
+			return
+		}
+		// A JSON body carries event and channels: the request alone is
+		// authorized first, so only authorized callers see parse errors.
+		isJSON := isJSONRequest(ctx)
+		event, channels := "", []string(nil)
+		if !isJSON {
+			event, channels = ctx.GetHeader(HeaderPublishEvent), splitList(ctx.GetHeader(HeaderPublishChannels))
+		}
+		if !s.authorizePublish(ctx, auth, event, channels) {
+			return
+		}
+
+		data, opts, ok := readPublishRequest(ctx)
+		if !ok {
+			return
+		}
+		if isJSON && !s.authorizePublish(ctx, auth, opts.Event, opts.Channels) {
+			return
+		}
+		s.publishRequest(ctx, data, opts)
+	}
+}
+
+// authorizePublish checks a publish with auth, answering when it is rejected.
+func (s *SSEServer) authorizePublish(ctx router.Context, auth PublishAuthorizer, event string, channels []string) bool {
+	err := auth.AuthorizePublish(ctx, event, channels)
+	if err == nil {
+		return true
+	}
+	s.tinySSE.log(LevelWarn, LogPublish, "event", event, "channels", channels, "error", err)
+	writeFailure(ctx, err, 403)
+	return false
+}
+
+// publishRequest publishes a message received over HTTP and answers it.
+// Rate limits answer 429; invalid messages 400.
+func (s *SSEServer) publishRequest(ctx router.Context, data []byte, opts PublishOptions) {
+	id, err := s.PublishWithID(data, opts)
+	if err != nil {
+		writeFailure(ctx, err, 400)
+		return
+	}
+	if id != "" {
+		ctx.SetHeader(HeaderEventID, id)
+	}
+	ctx.WriteStatus(204)
+}
+
+// readPublishRequest reads a JSON PublishRequest or a raw body with
+// X-SSE-* headers, answering 400 when it is invalid.
+func readPublishRequest(ctx router.Context) ([]byte, PublishOptions, bool) {
+	var data []byte
+	var event, channels string
+
+	if isJSONRequest(ctx) {
+		var req PublishRequest
+		if !readJSON(ctx, &req) {
+			return nil, PublishOptions{}, false
+		}
+		data, event, channels = []byte(req.Data), req.Event, req.Channels
+	} else {
+		body, err := ctx.Body()
+		if err != nil {
+			writeError(ctx, 400, "invalid request body: "+err.Error())
+			return nil, PublishOptions{}, false
+		}
+		data, event, channels = body, ctx.GetHeader(HeaderPublishEvent), ctx.GetHeader(HeaderPublishChannels)
+	}
+
+	opts := PublishOptions{Event: event, Channels: splitList(channels), IdempotencyKey: ctx.GetHeader(HeaderIdempotencyKey)}
+	if len(opts.Channels) == 0 {
+		writeError(ctx, 400, "channels required")
+		return nil, PublishOptions{}, false
+	}
+	return data, opts, true
+}
+
+func isJSONRequest(ctx router.Context) bool {
+	return HasPrefix(ctx.GetHeader("Content-Type"), "application/json")
+}
+
+// splitList parses a comma-separated list, skipping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, ch := range Split(s, ",") {
+		if ch = TrimSpace(ch); ch != "" {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// PublishOptions controls how SSEServer.PublishWith delivers a message.
+type PublishOptions struct {
+	// Event is the SSE event name. Empty = "message" in the browser.
+	Event string
+
+	// Channels receiving the message.
+	Channels []string
+
+	// Target selects the receiving connections with a channel set
+	// expression instead of Channels, e.g. "tenant:7 & role:admin" or
+	// "all - user:123" ('&' before '-' before '|', parentheses allowed).
+	// Targeted messages are replayed from history to matching connections
+	// only; they are not cached as state or stored in inboxes, and OnPublish
+	// gets no channels. They are tracked for reliable delivery to identities
+	// matching the target through a reliable channel. PublishRateLimits of the
+	// channels named apply to the message as a whole.
+	Target string
+
+	// Key identifies the state the message carries (e.g. "price:BTC").
+	// State channels cache the latest message per key. Defaults to Event.
+	Key string
+
+	// ConflationKey collapses queued updates for slow clients: a message still
+	// pending in a connection's queue is replaced by a newer one with the same
+	// key, so the client ends up with the newest value instead of a dropped
+	// or duplicated one. Empty = no conflation.
+	ConflationKey string
+
+	// TTL expires the message this long after publishing, overriding
+	// ServerConfig.MessageTTLs. 0 = the channels' TTL, if any.
+	TTL time.Duration
+
+	// IdempotencyKey suppresses retries: a publish repeating the key of one
+	// made within ServerConfig.IdempotencyWindow is not sent again, and
+	// PublishWithID returns the original message's ID and error (e.g.
+	// RateLimited for some channels). A publish that sent nothing and holds
+	// nothing back for RateThrottle is forgotten, so a retry sends it.
+	IdempotencyKey string
+
+	// Encoding overrides ServerConfig.PayloadEncoding for this message.
+	Encoding PayloadEncoding
+
+	// Origin is the connection ID of the client whose action caused the
+	// message (see SSEServer.Caller). It is skipped during fan-out, so the
+	// originating tab does not receive its own change back.
+	Origin string
+
+	// OriginKey skips every connection of this identity key instead, e.g. all
+	// tabs of the user who made the change.
+	OriginKey string
+
+	// Connection delivers the message only to the open connection with this
+	// ID (e.g. the tab that made a request), whatever its channels.
+	// Channels are ignored.
+	Connection string
+
+	// Anycast delivers the message to a single subscriber of Channels
+	// instead of all of them.
+	Anycast AnycastMode
+}
+
+// AnycastMode selects the one connection that receives an anycast message.
+type AnycastMode uint8
+
+const (
+	// AnycastNone delivers to every subscriber.
+	AnycastNone AnycastMode = iota
+	// AnycastRoundRobin rotates through the subscribers, oldest first.
+	AnycastRoundRobin
+	// AnycastLeastLoaded picks the subscriber with the fewest queued
+	// messages, rotating among equally loaded ones.
+	AnycastLeastLoaded
+)
+
+// ErrNoRecipient is returned by SSEServer.PublishWith when a direct or
+// anycast message has no open connection to go to.
+var ErrNoRecipient = Err("no recipient")
+
+// ErrQueueFull is returned by SSEServer.PublishWith when the queues of all
+// the connections a direct or anycast message could go to are full.
+var ErrQueueFull = Err("recipient queue full")
+
+// ErrInvalidEvent is returned for event names containing a line break, which
+// would inject fields or whole messages into the stream.
+var ErrInvalidEvent = Err("invalid event name: line breaks not allowed")
@@ -0,0 +1,117 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"sync"
+	"time"
+)
+
+// sendQueue is a connection's outbound queue. Unlike a channel it can replace
+// a pending message that shares a conflation key with a newer one.
+type sendQueue struct {
+	mu     sync.Mutex
+	items  []*outbound
+	limit  int
+	closed bool
+	notify chan struct{} // signaled when items are added or the queue closes
+}
+
+func newSendQueue(limit int) *sendQueue {
+	if limit <= 0 {
+		limit = 1
+	}
+	return &sendQueue{limit: limit, notify: make(chan struct{}, 1)}
+}
+
+// push queues out. A pending message with the same conflation key is removed
+// first, so the newest value takes its place at the tail (IDs stay ascending).
+// Returns conflated=true when an entry was replaced and ok=false when the
+// queue is full (or closed) and out was dropped. force ignores the limit.
+func (q *sendQueue) push(out *outbound, force bool) (conflated, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false, false
+	}
+	if out.conflationKey != "" {
+		for i, pending := range q.items {
+			if pending.conflationKey == out.conflationKey {
+				q.items = append(q.items[:i], q.items[i+1:]...)
+				conflated = true
+				break
+			}
+		}
+	}
+	if !force && len(q.items) >= q.limit {
+		return conflated, false
+	}
+
+	q.items = append(q.items, out)
+	q.signal()
+	return conflated, true
+}
+
+// pop blocks until messages are queued and returns all of them.
+// ok is false once the queue is closed and drained.
+func (q *sendQueue) pop() (batch []*outbound, ok bool) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			batch, q.items = q.items, nil
+			q.mu.Unlock()
+			return batch, true
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return nil, false
+		}
+		q.mu.Unlock()
+		<-q.notify
+	}
+}
+
+// popUntil is like pop but gives up at deadline, returning nothing.
+func (q *sendQueue) popUntil(deadline time.Time) []*outbound {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 || q.closed {
+			batch := q.items
+			q.items = nil
+			q.mu.Unlock()
+			return batch
+		}
+		q.mu.Unlock()
+		select {
+		case <-q.notify:
+		case <-timer.C:
+			return nil
+		}
+	}
+}
+
+// len returns the number of queued messages.
+func (q *sendQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// close wakes up pop; pending messages are still returned.
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.signal()
+	q.mu.Unlock()
+}
+
+// signal must be called with q.mu held.
+func (q *sendQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
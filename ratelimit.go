@@ -0,0 +1,279 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Rate limit actions reported in MetricMessagesRateLimited and LogRateLimited.
+const (
+	rateRejected = "rejected"
+	rateDelayed  = "delayed"
+	rateReplaced = "replaced"
+)
+
+// rateIdleSweep is how often budgets that refilled completely are dropped.
+const rateIdleSweep = time.Minute
+
+// publishRates holds the PublishRateLimits state of the limited channels
+// published to recently.
+type publishRates struct {
+	mu        sync.Mutex
+	limits    []PublishRateLimit
+	channels  map[string]*channelRate
+	lastSweep time.Time
+}
+
+// channelRate is the publish budget of one channel.
+type channelRate struct {
+	limit   *PublishRateLimit
+	bucket  *tokenBucket
+	pending *heldMessage // RateThrottle: message held back, nil when none
+	free    time.Time    // RateThrottle: when the token reserved for pending frees up
+}
+
+// heldMessage is a message RateThrottle holds back. It is released once, to
+// the channels it is still held for, when all their reserved tokens are free.
+type heldMessage struct {
+	bMsg     *broadcastMessage
+	channels []throttledChannel // shrinks as newer messages replace it
+	at       time.Time
+}
+
+func newPublishRates(limits []PublishRateLimit) *publishRates {
+	return &publishRates{limits: limits, channels: make(map[string]*channelRate), lastSweep: time.Now()}
+}
+
+// get returns the budget of channel, or nil if no limit matches it. Must be
+// called with mu held, which also keeps the idle sweep from dropping the
+// budget while the caller uses it.
+func (p *publishRates) get(channel string) *channelRate {
+	if now := time.Now(); now.Sub(p.lastSweep) >= rateIdleSweep {
+		p.lastSweep = now
+		p.sweepIdle()
+	}
+	if r := p.channels[channel]; r != nil {
+		return r
+	}
+	for i := range p.limits {
+		l := &p.limits[i]
+		if l.Rate > 0 && matchAnyChannel(l.Channels, channel) {
+			r := &channelRate{limit: l, bucket: newTokenBucket(l.Rate, l.Burst)}
+			p.channels[channel] = r
+			return r
+		}
+	}
+	return nil
+}
+
+// sweepIdle drops budgets that refilled completely and hold nothing back: a
+// new budget behaves the same. Must be called with mu held.
+func (p *publishRates) sweepIdle() {
+	for ch, r := range p.channels {
+		if r.pending == nil && r.bucket.full() {
+			delete(p.channels, ch)
+		}
+	}
+}
+
+// publishLimited applies PublishRateLimits to bMsg and sends what is allowed.
+// Reports whether bMsg was sent to any channel right away, and whether it is
+// held back for some by RateThrottle.
+func (s *SSEServer) publishLimited(bMsg *broadcastMessage) (sent, held bool, err error) {
+	if bMsg.target != nil {
+		sent, err = s.publishTargetLimited(bMsg)
+		return sent, false, err
+	}
+	var allowed, rejected []string
+	var throttled []throttledChannel
+	var delay time.Duration
+	retry := 0.0
+
+	s.rates.mu.Lock()
+	for _, ch := range bMsg.channels {
+		r := s.rates.get(ch)
+		if r == nil {
+			allowed = append(allowed, ch)
+			continue
+		}
+
+		switch r.limit.Policy {
+		case RateThrottle:
+			throttled = append(throttled, throttledChannel{ch, r})
+			continue
+		case RateDelay:
+			wait, ok := r.bucket.reserve(r.maxWait())
+			if !ok {
+				rejected = append(rejected, ch)
+				retry = max(retry, wait.Seconds())
+				s.rateLimited(ch, r, rateRejected)
+				continue
+			}
+			if wait > 0 {
+				delay = max(delay, wait)
+				s.rateLimited(ch, r, rateDelayed)
+			}
+		default:
+			if wait, ok := r.bucket.reserve(0); !ok {
+				rejected = append(rejected, ch)
+				retry = max(retry, wait.Seconds())
+				s.rateLimited(ch, r, rateRejected)
+				continue
+			}
+		}
+		allowed = append(allowed, ch)
+	}
+	if len(throttled) > 0 {
+		allowed, held = s.throttle(bMsg, throttled, allowed)
+	}
+	s.rates.mu.Unlock()
+
+	sent = len(allowed) > 0
+	if sent {
+		time.Sleep(delay)
+		bMsg.channels = allowed
+		s.hub.broadcast <- bMsg
+	}
+	if len(rejected) > 0 {
+		err = RateLimited("publish rate exceeded for "+JoinSlice(rejected, ", "), int(math.Ceil(retry)))
+	}
+	return sent, held, err
+}
+
+// publishTargetLimited applies PublishRateLimits to a Target message as a
+// whole, through the channels it reaches: it waits under RateDelay and is
+// rejected when any of them is over budget otherwise, since the expression
+// cannot be split into a sent and a held part.
+func (s *SSEServer) publishTargetLimited(bMsg *broadcastMessage) (sent bool, err error) {
+	var rejected, seen []string
+	var delay time.Duration
+	retry := 0.0
+
+	s.rates.mu.Lock()
+	for _, ch := range bMsg.target.reach() {
+		if containsString(seen, ch) {
+			continue
+		}
+		seen = append(seen, ch)
+		r := s.rates.get(ch)
+		if r == nil {
+			continue
+		}
+		wait, ok := r.bucket.reserve(r.maxWait())
+		if !ok {
+			rejected = append(rejected, ch)
+			retry = max(retry, wait.Seconds())
+			s.rateLimited(ch, r, rateRejected)
+			continue
+		}
+		if wait > 0 {
+			delay = max(delay, wait)
+			s.rateLimited(ch, r, rateDelayed)
+		}
+	}
+	s.rates.mu.Unlock()
+
+	if len(rejected) > 0 {
+		return false, RateLimited("publish rate exceeded for "+JoinSlice(rejected, ", "), int(math.Ceil(retry)))
+	}
+	time.Sleep(delay)
+	s.hub.broadcast <- bMsg
+	return true, nil
+}
+
+// maxWait is how long a publish may wait for a token of r.
+func (r *channelRate) maxWait() time.Duration {
+	if r.limit.Policy != RateDelay {
+		return 0
+	}
+	if r.limit.MaxDelay <= 0 {
+		return math.MaxInt64
+	}
+	return r.limit.MaxDelay
+}
+
+type throttledChannel struct {
+	channel string
+	r       *channelRate
+}
+
+// throttle adds the channels whose budget allows bMsg to allowed and holds
+// one copy back for the others, replacing any message already held there.
+// Reports whether a copy is held. Must be called with rates.mu held.
+func (s *SSEServer) throttle(bMsg *broadcastMessage, channels []throttledChannel, allowed []string) ([]string, bool) {
+	hm := &heldMessage{}
+	now := time.Now()
+	for _, c := range channels {
+		if old := c.r.pending; old != nil {
+			// The token reserved for the older message is used by this one.
+			for i, oc := range old.channels {
+				if oc.r == c.r {
+					old.channels = append(old.channels[:i:i], old.channels[i+1:]...)
+					break
+				}
+			}
+			s.rateLimited(c.channel, c.r, rateReplaced)
+		} else if wait, _ := c.r.bucket.reserve(math.MaxInt64); wait > 0 {
+			c.r.free = now.Add(wait)
+		} else {
+			allowed = append(allowed, c.channel)
+			continue
+		}
+		c.r.pending = hm
+		hm.channels = append(hm.channels, c)
+		if c.r.free.After(hm.at) {
+			hm.at = c.r.free
+		}
+	}
+	if len(hm.channels) == 0 {
+		return allowed, false
+	}
+
+	hm.bMsg = heldPart(bMsg, allowed)
+	time.AfterFunc(time.Until(hm.at), func() { s.release(hm) })
+	return allowed, true
+}
+
+// release sends hm to the channels it is still held for.
+func (s *SSEServer) release(hm *heldMessage) {
+	s.rates.mu.Lock()
+	var channels []string
+	for _, c := range hm.channels {
+		c.r.pending = nil
+		channels = append(channels, c.channel)
+	}
+	hm.channels = nil
+	s.rates.mu.Unlock()
+
+	if len(channels) > 0 {
+		hm.bMsg.channels = channels
+		s.hub.broadcast <- hm.bMsg
+	}
+}
+
+// heldPart returns the copy of bMsg held back by RateThrottle. It skips
+// subscribers of the channels sent right away, and gets an ID of its own when
+// released so IDs stay in send order.
+func heldPart(bMsg *broadcastMessage, sent []string) *broadcastMessage {
+	out := *bMsg
+	msg := *bMsg.msg
+	out.msg = &msg
+	out.except = append([]string(nil), sent...)
+	out.counted = len(sent) > 0
+	out.assigned = nil // PublishWithID does not wait for held parts
+	return &out
+}
+
+func (s *SSEServer) rateLimited(channel string, r *channelRate, action string) {
+	s.hub.metrics.Add(MetricMessagesRateLimited, 1, "channel", channel, "action", action)
+	level := LevelDebug
+	if action == rateRejected {
+		level = LevelWarn
+	}
+	s.tinySSE.log(level, LogRateLimited, "channel", channel, "policy", r.limit.Policy.String(), "action", action)
+}
@@ -0,0 +1,320 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"time"
+
+	"github.com/tinywasm/router"
+)
+
+// Defaults of the reliable delivery settings.
+const (
+	defaultReliableMaxPending     = 100
+	defaultReliableRedeliverAfter = 30 * time.Second
+	defaultReliableRetention      = 10 * time.Minute
+)
+
+// reliableMember holds the unacknowledged messages of one identity key.
+type reliableMember struct {
+	channels []string // reliable channels of its connections
+	all      []string // every channel of its connections, for targets
+	pending  []*pendingMessage
+	conns    int
+	lastSeen time.Time // when its last connection closed
+}
+
+type pendingMessage struct {
+	msg       *SSEMessage
+	route     route // who may get it: the origin stays skipped on redelivery
+	sentAt    time.Time
+	expiresAt time.Time
+}
+
+func (p *pendingMessage) outbound() *outbound {
+	out := newOutbound(p.msg)
+	out.expiresAt = p.expiresAt
+	return out
+}
+
+// reliableJoin starts tracking client's identity once it has a reliable
+// channel, and adds what it has not acknowledged to cu for redelivery.
+// Connections without an identity key are not tracked: a reconnect gets a new
+// ID, so nobody could ever acknowledge their messages. Must run on the hub
+// goroutine.
+func (h *hub) reliableJoin(client *clientConnection, cu *catchUp) {
+	if client.key == client.id || !h.hasReliable(client.channels) {
+		return
+	}
+	m := h.reliable[client.key]
+	if m == nil {
+		m = &reliableMember{}
+		h.reliable[client.key] = m
+	}
+	m.add(client.channels, h.config.ReliableChannels)
+	if client.reliable {
+		return // already counted; gained channels only
+	}
+	client.reliable = true
+	m.conns++
+
+	now := time.Now()
+	redelivered := 0
+	for _, p := range m.pending {
+		p.sentAt = now
+		if !expired(p.expiresAt, now) && h.receives(client, p.route) && cu.add(p.outbound(), true) {
+			redelivered++
+		}
+	}
+	if redelivered > 0 {
+		h.metrics.Add(MetricMessagesRedelivered, float64(redelivered))
+		h.tinySSE.log(LevelDebug, LogRedeliver, "conn", client.id, "key", client.key, "count", redelivered)
+	}
+}
+
+// add tracks channels of a connection for the member.
+func (m *reliableMember) add(channels, reliable []string) {
+	for _, ch := range channels {
+		if matchAnyChannel(reliable, ch) && !containsString(m.channels, ch) {
+			m.channels = append(m.channels, ch)
+		}
+		if !containsString(m.all, ch) {
+			m.all = append(m.all, ch)
+		}
+	}
+}
+
+// reliableUnsubscribe stops tracking the channels client left that no other
+// open connection of its identity has, and stops counting client once it has
+// no reliable channel left. Must run on the hub goroutine.
+func (h *hub) reliableUnsubscribe(client *clientConnection, removed []string) {
+	m := h.reliable[client.key]
+	if !client.reliable || m == nil {
+		return
+	}
+	for _, ch := range removed {
+		kept := false
+		for _, other := range h.byKey[client.key] {
+			if other.reliable && containsString(other.channels, ch) {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			m.channels = removeString(m.channels, ch)
+			m.all = removeString(m.all, ch)
+		}
+	}
+	if !h.hasReliable(client.channels) {
+		h.reliableLeave(client)
+	}
+}
+
+// reliableLeave notes that a counted connection of client's identity closed
+// or left its reliable channels; pending messages are kept for
+// ReliableRetention. Must run on the hub goroutine.
+func (h *hub) reliableLeave(client *clientConnection) {
+	if !client.reliable {
+		return
+	}
+	client.reliable = false
+	if m := h.reliable[client.key]; m != nil && m.conns > 0 {
+		m.conns--
+		m.lastSeen = time.Now()
+	}
+}
+
+func (h *hub) hasReliable(channels []string) bool {
+	for _, ch := range channels {
+		if matchAnyChannel(h.config.ReliableChannels, ch) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackReliable records bMsg as pending for every identity it is routed to
+// through one of its reliable channels. Must run on the hub goroutine.
+func (h *hub) trackReliable(bMsg *broadcastMessage) {
+	if len(h.reliable) == 0 {
+		return
+	}
+	limit := h.config.ReliableMaxPending
+	if limit <= 0 {
+		limit = defaultReliableMaxPending
+	}
+	r := bMsg.route
+	r.except = nil // only for the held part of a throttled message, skipped below
+	now := time.Now()
+	for key, m := range h.reliable {
+		if !h.reliableFor(key, m, bMsg.route) {
+			continue
+		}
+		m.pending = append(m.pending, &pendingMessage{msg: bMsg.msg, route: r, sentAt: now, expiresAt: bMsg.expiresAt})
+		if over := len(m.pending) - limit; over > 0 {
+			m.pending = m.pending[over:]
+			h.metrics.Add(MetricMessagesDropped, float64(over))
+			h.tinySSE.log(LevelWarn, LogSlowClient, "key", key, "dropped", over)
+		}
+	}
+	h.reportPending()
+}
+
+// reliableFor reports whether a message routed by r is tracked for the
+// identity key: it must reach one of m's reliable channels and not be an echo
+// to its sender. Must run on the hub goroutine.
+func (h *hub) reliableFor(key string, m *reliableMember, r route) bool {
+	if key == r.originKey || intersects(m.all, r.except) {
+		return false // the sender, or already tracked with the first part
+	}
+	if r.target != nil {
+		if !r.target.match(m.all) || !intersects(m.channels, r.target.reach()) {
+			return false
+		}
+	} else if !intersects(m.channels, r.channels) {
+		return false
+	}
+	if origin := h.conns[r.origin]; origin != nil && origin.key == key {
+		// Only tracked when another connection of the sender gets it.
+		for _, client := range h.byKey[key] {
+			if h.receives(client, r) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ack removes ids from the pending messages of connID's identity.
+// Returns false if connID is not connected.
+func (h *hub) ack(connID string, ids []string) bool {
+	found := false
+	h.do(func() {
+		client := h.conns[connID]
+		if client == nil {
+			return
+		}
+		found = true
+		m := h.reliable[client.key]
+		if m == nil {
+			return
+		}
+		kept := m.pending[:0]
+		for _, p := range m.pending {
+			if !containsString(ids, p.msg.Id) {
+				kept = append(kept, p)
+			}
+		}
+		clear(m.pending[len(kept):])
+		m.pending = kept
+		h.reportPending()
+	})
+	return found
+}
+
+// sweepReliable redelivers messages unacknowledged for ReliableRedeliverAfter
+// to the open connections of their identity and forgets identities gone for
+// longer than ReliableRetention. Must run on the hub goroutine.
+func (h *hub) sweepReliable() {
+	redeliverAfter := h.config.ReliableRedeliverAfter
+	if redeliverAfter <= 0 {
+		redeliverAfter = defaultReliableRedeliverAfter
+	}
+	retention := h.config.ReliableRetention
+	if retention <= 0 {
+		retention = defaultReliableRetention
+	}
+
+	now := time.Now()
+	for key, m := range h.reliable {
+		if m.conns == 0 {
+			if now.Sub(m.lastSeen) > retention {
+				delete(h.reliable, key)
+			}
+			continue
+		}
+		for _, p := range m.pending {
+			if now.Sub(p.sentAt) < redeliverAfter || expired(p.expiresAt, now) {
+				continue
+			}
+			p.sentAt = now
+			for _, client := range h.byKey[key] {
+				if h.receives(client, p.route) {
+					h.push(client, p.outbound(), true)
+				}
+			}
+			h.metrics.Add(MetricMessagesRedelivered, 1)
+			h.tinySSE.log(LevelDebug, LogRedeliver, "key", key, "id", p.msg.Id)
+		}
+	}
+	h.reportPending()
+}
+
+// runReliableSweeper ticks sweepReliable on the hub goroutine until the hub
+// stops.
+func (h *hub) runReliableSweeper() {
+	interval := h.config.ReliableRedeliverAfter / 2
+	if interval <= 0 {
+		interval = defaultReliableRedeliverAfter / 2
+	}
+	h.tick(interval, h.sweepReliable)
+}
+
+func (h *hub) reportPending() {
+	total := 0
+	for _, m := range h.reliable {
+		total += len(m.pending)
+	}
+	h.metrics.Set(MetricMessagesPending, float64(total))
+}
+
+// removeString returns list without s, copied so readers of list are unaffected.
+func removeString(list []string, s string) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func intersects(a, b []string) bool {
+	for _, s := range a {
+		if containsString(b, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AckHandler returns the handler clients use to acknowledge messages of
+// ServerConfig.ReliableChannels: a POST with the connection ID in the
+// X-SSE-Connection header and comma-separated message IDs as body.
+// Answers 204, 404 when the connection is not open, or 403 when the request
+// does not come from the connection's identity (see Caller).
+// Register it with: r.Post("/events/ack", server.AckHandler())
+func (s *SSEServer) AckHandler() func(ctx router.Context) {
+	return func(ctx router.Context) {
+		conn, ok := s.connection(ctx.GetHeader(HeaderConnection))
+		if !ok {
+			writeError(ctx, 404, "connection not found")
+			return
+		}
+		if !s.owns(ctx, conn) {
+			writeError(ctx, 403, "connection belongs to another identity")
+			return
+		}
+		body, err := ctx.Body()
+		if err != nil {
+			writeError(ctx, 400, "invalid request body: "+err.Error())
+			return
+		}
+		if !s.hub.ack(conn.ID, splitList(string(body))) {
+			writeError(ctx, 404, "connection not found")
+			return
+		}
+		ctx.WriteStatus(204)
+	}
+}
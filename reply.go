@@ -0,0 +1,21 @@
+package sse
+
+import "bytes"
+
+// A ReplyEvent's data is "<call ID>\n<error kind>\n<payload>": the error kind
+// is empty on success, otherwise the payload is the error message. The
+// payload is sent with EncodingAuto so binary results survive EventSource.
+// The server encodes it in rpc.go.
+
+// decodeReply parses the data of a ReplyEvent. ok is false if it is malformed.
+func decodeReply(data []byte) (callID, kind string, payload []byte, ok bool) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return "", "", nil, false
+	}
+	callID, data = string(data[:i]), data[i+1:]
+	if i = bytes.IndexByte(data, '\n'); i < 0 {
+		return "", "", nil, false
+	}
+	return callID, string(data[:i]), DecodePayload(data[i+1:]), true
+}
@@ -0,0 +1,92 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"errors"
+
+	"github.com/tinywasm/router"
+)
+
+// CallHandler returns the handler of request/response calls over the stream
+// (see SSEClient.Call): clients POST to it with their connection ID in the
+// X-SSE-Connection header, a correlation ID in X-SSE-Call, the method in
+// X-SSE-Event and the arguments as body. The call goes to ServerConfig.OnCall
+// and is answered 202; its result reaches the client later as a ReplyEvent
+// on the same connection, sent with Reply or ReplyError.
+// Register it with: r.Post("/events/call", server.CallHandler())
+func (s *SSEServer) CallHandler() func(ctx router.Context) {
+	return func(ctx router.Context) {
+		if s.config.OnCall == nil {
+			writeError(ctx, 501, "calls not enabled")
+			return
+		}
+		callID := ctx.GetHeader(HeaderCall)
+		if callID == "" {
+			writeError(ctx, 400, "call ID required")
+			return
+		}
+
+		conn, method, data, ok := s.readUpstream(ctx)
+		if !ok {
+			return
+		}
+		call := &SSEMessage{Id: callID, Event: method, Data: data}
+
+		s.hub.metrics.Add(MetricCallsReceived, 1)
+		if err := s.config.OnCall(conn, call); err != nil {
+			s.tinySSE.log(LevelDebug, LogCall, "conn", conn.ID, "method", call.Event, "call", callID, "error", err)
+			writeFailure(ctx, err, 400)
+			return
+		}
+		ctx.WriteStatus(202)
+	}
+}
+
+// Reply sends the result of call callID to connection connID.
+// Returns false if the connection is no longer open; the client's call then
+// fails with its timeout.
+func (s *SSEServer) Reply(connID, callID string, data []byte) bool {
+	return s.reply(connID, callID, "", data)
+}
+
+// ReplyError fails call callID of connection connID with err. An *SSEError
+// keeps its kind on the client; any other error arrives as ErrorServer.
+// Returns false if the connection is no longer open.
+func (s *SSEServer) ReplyError(connID, callID string, err error) bool {
+	kind, msg := ErrorServer, err.Error()
+	var sseErr *SSEError
+	if errors.As(err, &sseErr) {
+		kind, msg = sseErr.Kind, sseErr.Message
+	}
+	return s.reply(connID, callID, kind.String(), []byte(msg))
+}
+
+// encodeReply returns the data of a ReplyEvent (see decodeReply).
+func encodeReply(callID string, kind string, payload []byte) []byte {
+	payload = EncodePayload(payload, EncodingAuto)
+	out := make([]byte, 0, len(callID)+len(kind)+len(payload)+2)
+	out = append(out, callID...)
+	out = append(out, '\n')
+	out = append(out, kind...)
+	out = append(out, '\n')
+	return append(out, payload...)
+}
+
+func (s *SSEServer) reply(connID, callID, kind string, data []byte) bool {
+	out := newControl(ReplyEvent, string(encodeReply(callID, kind, data)))
+	found := false
+	s.hub.do(func() {
+		if client := s.hub.conns[connID]; client != nil {
+			found = s.hub.push(client, out, true) // behind a pending catch-up
+		}
+	})
+	if found {
+		result := kind
+		if result == "" {
+			result = "ok"
+		}
+		s.hub.metrics.Add(MetricCallsReplied, 1, "result", result)
+	}
+	return found
+}
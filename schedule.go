@@ -0,0 +1,270 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// Scheduled is a publish waiting for its time (see SSEServer.PublishAt).
+type Scheduled struct {
+	s   *scheduler
+	job *scheduledJob
+}
+
+// ID identifies the scheduled publish, also after a restart with a
+// ScheduleStore (see SSEServer.CancelScheduled).
+func (sc *Scheduled) ID() string { return sc.job.id }
+
+// At is when the message is published.
+func (sc *Scheduled) At() time.Time { return sc.job.at }
+
+// Cancel stops the publish. Returns false if it already happened or was
+// canceled before.
+func (sc *Scheduled) Cancel() bool { return sc.s.cancel(sc.job.id) }
+
+// PublishAt publishes data with opts at time at, or right away when at is
+// in the past. The returned handle cancels it. With a ServerConfig.ScheduleStore
+// it is persisted first, with all of opts. Fails if opts.Target or opts.Event
+// is invalid, the store fails or after Shutdown.
+func (s *SSEServer) PublishAt(at time.Time, data []byte, opts PublishOptions) (*Scheduled, error) {
+	if !validEvent(opts.Event) {
+		return nil, ErrInvalidEvent
+	}
+	if opts.Target != "" {
+		if _, err := parseTarget(opts.Target); err != nil {
+			return nil, err
+		}
+	}
+	job := &scheduledJob{id: newRandomID(), at: at, data: data, opts: opts}
+	if err := s.schedule.add(job, true); err != nil {
+		return nil, err
+	}
+	return &Scheduled{s: s.schedule, job: job}, nil
+}
+
+// PublishAfter publishes data with opts once d has elapsed; see PublishAt.
+func (s *SSEServer) PublishAfter(d time.Duration, data []byte, opts PublishOptions) (*Scheduled, error) {
+	return s.PublishAt(time.Now().Add(d), data, opts)
+}
+
+// CancelScheduled cancels the scheduled publish id, e.g. one loaded from the
+// ScheduleStore whose handle was lost in a restart. Returns false if it is
+// not pending.
+func (s *SSEServer) CancelScheduled(id string) bool {
+	return s.schedule.cancel(id)
+}
+
+// Shutdown stops scheduled publishing and the background sweepers. Publishes
+// not yet due are dropped, or stay in the ScheduleStore for the next server;
+// PublishAt fails afterwards. Open streams are not affected.
+func (s *SSEServer) Shutdown() {
+	s.schedule.stop()
+	s.hub.stop()
+}
+
+// scheduler keeps scheduled publishes in a heap ordered by time and arms a
+// single timer for the earliest one.
+type scheduler struct {
+	server *SSEServer
+	store  ScheduleStore
+
+	mu      sync.Mutex
+	jobs    jobHeap
+	byID    map[string]*scheduledJob
+	timer   *time.Timer
+	stopped bool
+}
+
+type scheduledJob struct {
+	id    string
+	at    time.Time
+	data  []byte
+	opts  PublishOptions
+	index int // position in jobs
+}
+
+func newScheduler(s *SSEServer, store ScheduleStore) *scheduler {
+	sch := &scheduler{server: s, store: store, byID: make(map[string]*scheduledJob)}
+	if store == nil {
+		return sch
+	}
+	stored, err := store.Load()
+	if err != nil {
+		s.tinySSE.log(LevelError, LogSchedule, "op", "load", "error", err)
+		return sch
+	}
+	for _, p := range stored {
+		sch.add(jobFromRecord(p), false) //nolint:errcheck // nothing to save
+	}
+	return sch
+}
+
+// add queues job, saving it to the store when persist is set.
+func (sch *scheduler) add(job *scheduledJob, persist bool) error {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	if sch.stopped {
+		return Err("server shut down")
+	}
+	if persist && sch.store != nil {
+		if err := sch.store.Save(job.record()); err != nil {
+			return err
+		}
+	}
+	heap.Push(&sch.jobs, job)
+	sch.byID[job.id] = job
+	sch.arm()
+	return nil
+}
+
+// cancel removes the pending job id.
+func (sch *scheduler) cancel(id string) bool {
+	sch.mu.Lock()
+	job := sch.byID[id]
+	if job == nil {
+		sch.mu.Unlock()
+		return false
+	}
+	heap.Remove(&sch.jobs, job.index)
+	delete(sch.byID, id)
+	sch.arm()
+	sch.mu.Unlock()
+
+	sch.forget(id)
+	return true
+}
+
+// fire publishes every due job. Runs on the timer's goroutine.
+func (sch *scheduler) fire() {
+	sch.mu.Lock()
+	if sch.stopped {
+		sch.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	var due []*scheduledJob
+	for len(sch.jobs) > 0 && !sch.jobs[0].at.After(now) {
+		job := heap.Pop(&sch.jobs).(*scheduledJob)
+		delete(sch.byID, job.id)
+		due = append(due, job)
+	}
+	sch.arm()
+	sch.mu.Unlock()
+
+	for _, job := range due {
+		if err := sch.server.PublishWith(job.data, job.opts); err != nil {
+			sch.server.tinySSE.log(LevelWarn, LogSchedule, "op", "publish", "id", job.id, "event", job.opts.Event, "error", err)
+		}
+		sch.forget(job.id)
+	}
+}
+
+// arm sets the timer for the earliest job. Must be called with mu held.
+func (sch *scheduler) arm() {
+	sch.server.hub.metrics.Set(MetricScheduledPending, float64(len(sch.jobs)))
+	if len(sch.jobs) == 0 {
+		if sch.timer != nil {
+			sch.timer.Stop()
+		}
+		return
+	}
+	d := time.Until(sch.jobs[0].at)
+	if sch.timer == nil {
+		sch.timer = time.AfterFunc(d, sch.fire)
+		return
+	}
+	sch.timer.Reset(d)
+}
+
+func (sch *scheduler) stop() {
+	sch.mu.Lock()
+	defer sch.mu.Unlock()
+	sch.stopped = true
+	if sch.timer != nil {
+		sch.timer.Stop()
+	}
+}
+
+// forget removes a fired or canceled job from the store.
+func (sch *scheduler) forget(id string) {
+	if sch.store == nil {
+		return
+	}
+	if err := sch.store.Delete(id); err != nil {
+		sch.server.tinySSE.log(LevelError, LogSchedule, "op", "delete", "id", id, "error", err)
+	}
+}
+
+func (j *scheduledJob) record() *ScheduledPublish {
+	return &ScheduledPublish{
+		Id:       j.id,
+		At:       j.at.UnixMilli(),
+		Event:    j.opts.Event,
+		Channels: JoinSlice(j.opts.Channels, ","),
+		Target:   j.opts.Target,
+		Key:      j.opts.Key,
+		Ttl:      j.opts.TTL.Milliseconds(),
+
+		ConflationKey:  j.opts.ConflationKey,
+		IdempotencyKey: j.opts.IdempotencyKey,
+		Encoding:       int64(j.opts.Encoding),
+		Origin:         j.opts.Origin,
+		OriginKey:      j.opts.OriginKey,
+		Connection:     j.opts.Connection,
+		Anycast:        int64(j.opts.Anycast),
+		Data:           j.data,
+	}
+}
+
+func jobFromRecord(p *ScheduledPublish) *scheduledJob {
+	return &scheduledJob{
+		id:   p.Id,
+		at:   time.UnixMilli(p.At),
+		data: p.Data,
+		opts: PublishOptions{
+			Event:    p.Event,
+			Channels: splitList(p.Channels),
+			Target:   p.Target,
+			Key:      p.Key,
+			TTL:      time.Duration(p.Ttl) * time.Millisecond,
+
+			ConflationKey:  p.ConflationKey,
+			IdempotencyKey: p.IdempotencyKey,
+			Encoding:       PayloadEncoding(p.Encoding),
+			Origin:         p.Origin,
+			OriginKey:      p.OriginKey,
+			Connection:     p.Connection,
+			Anycast:        AnycastMode(p.Anycast),
+		},
+	}
+}
+
+// jobHeap orders jobs by time (container/heap).
+type jobHeap []*scheduledJob
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x any) {
+	job := x.(*scheduledJob)
+	job.index = len(*h)
+	*h = append(*h, job)
+}
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	job := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return job
+}
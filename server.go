@@ -3,6 +3,13 @@
 package sse
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+
+	. "github.com/tinywasm/fmt"
 	"github.com/tinywasm/router"
 )
 
@@ -11,95 +18,350 @@ type SSEServer struct {
 	tinySSE *tinySSE
 	config  *ServerConfig
 	hub     *hub
+	traffic trafficStats
+
+	admission *tokenBucket  // nil when AdmissionRate is 0
+	rates     *publishRates // nil without PublishRateLimits
+	schedule  *scheduler
+
+	idempotency *idempotency
 }
 
 // Server creates a new SSEServer instance.
 func (t *tinySSE) Server(c *ServerConfig) *SSEServer {
-	return &SSEServer{
+	s := &SSEServer{
 		tinySSE: t,
 		config:  c,
 		hub:     newHub(t, c),
 	}
+	if c.AdmissionRate > 0 {
+		s.admission = newTokenBucket(c.AdmissionRate, c.AdmissionBurst)
+	}
+	if len(c.PublishRateLimits) > 0 {
+		s.rates = newPublishRates(c.PublishRateLimits)
+	}
+	if _, ok := c.ChannelProvider.(IdentityProvider); len(c.ReliableChannels) > 0 && !ok {
+		t.log(LevelWarn, LogConfig, "setting", "ReliableChannels", "error", "ChannelProvider is not an IdentityProvider; nothing is tracked")
+	}
+	if len(c.ReliableChannels) > 0 {
+		t.log(LevelWarn, LogConfig, "setting", "ReliableChannels", "error", "SSEClient acknowledges unnamed events only; named events are redelivered until ReliableMaxPending drops them")
+	}
+	s.idempotency = newIdempotency(c.IdempotencyWindow)
+	// Last: loaded publishes may fire right away.
+	s.schedule = newScheduler(s, c.ScheduleStore)
+	return s
 }
 
 // StreamHandler returns a router.StreamFunc that serves SSE to a connected Streamer.
 // Register it with: r.Stream(path, server.StreamHandler())
 func (s *SSEServer) StreamHandler() router.StreamFunc {
 	return func(st router.Streamer) {
-		// 1. Resolve channels
-		var channels []string
-		var err error
-
-		if s.config.ChannelProvider != nil {
-			channels, err = s.config.ChannelProvider.ResolveChannels(st)
-		} else {
-			st.WriteStatus(500)
-			st.Write([]byte("channel provider not configured\n")) //nolint:errcheck
+		// A probe only asks whether a stream would be accepted.
+		if st.GetHeader(HeaderProbe) != "" {
+			s.probeStream(st)
+			return
+		}
+
+		// 0. Admission control, before any per-connection work
+		if !s.admitStream(st) {
 			return
 		}
 
+		// 1. Resolve channels and 2. create the client connection
+		client, err := s.newClient(st)
 		if err != nil {
-			st.WriteStatus(401)
-			st.Write([]byte(err.Error() + "\n")) //nolint:errcheck
+			s.reject(st, err)
 			return
 		}
+		channels := client.channels
 
-		// 2. Set SSE headers
+		// 3. Register, subject to connection limits. Handle Last-Event-ID for replay
+		req := registerRequest{
+			client:      client,
+			lastEventID: st.GetHeader("Last-Event-ID"),
+			admitted:    make(chan *SSEError, 1),
+		}
+		s.hub.register <- req
+		if err := <-req.admitted; err != nil {
+			s.reject(st, err)
+			return
+		}
+
+		// 4. Set SSE headers
 		st.SetHeader("Content-Type", "text/event-stream")
 		st.SetHeader("Cache-Control", "no-cache")
 		st.SetHeader("Connection", "keep-alive")
+		w := s.negotiateEncoding(st)
 
-		// 3. Flush headers so the client knows the connection is open
+		// Flush headers and the connection ID so the client knows the connection is open
 		st.WriteStatus(200)
-		st.Flush()
+		w.write(newControl(ConnectedEvent, client.id).data) //nolint:errcheck // a gone client fails on the next write
 
-		// 4. Create client connection
-		client := &clientConnection{
-			channels: channels,
-			send:     make(chan []byte, s.config.ClientChannelBuffer),
-		}
-
-		// Handle Last-Event-ID for replay
-		lastEventID := st.GetHeader("Last-Event-ID")
-
-		s.hub.register <- registerRequest{
-			client:      client,
-			lastEventID: lastEventID,
+		s.tinySSE.log(LevelInfo, LogConnect, "conn", client.id, "key", client.key, "channels", channels)
+		if s.config.OnConnect != nil {
+			s.config.OnConnect(client.info())
 		}
 
 		// Ensure unregister on exit
+		reason := DisconnectServerClosed
+		var writeErr error
 		defer func() {
+			if writeErr == nil {
+				w.close()
+			}
+			if writeErr == nil && client.closeReason != "" {
+				// Set by the hub before it closed the queue.
+				reason = client.closeReason
+			}
 			s.hub.unregister <- client
+			fields := []any{"conn", client.id, "channels", client.channelList(), "reason", reason}
+			if writeErr != nil {
+				fields = append(fields, "error", writeErr)
+			}
+			s.tinySSE.log(LevelInfo, LogDisconnect, fields...)
+			if s.config.OnDisconnect != nil {
+				s.config.OnDisconnect(client.info(), reason)
+			}
 		}()
 
-		// 5. Loop: push messages until the client disconnects (Write error) or hub closes send
-		for msg := range client.send {
-			if _, err := st.Write(msg); err != nil {
+		// 5. Loop: push messages until the client disconnects (Write error) or hub closes the queue
+		for {
+			batch, ok := client.queue.pop()
+			if !ok {
 				return
 			}
-			st.Flush()
+			if err := s.writeBatch(w, client, s.fillBatch(client.queue, batch)); err != nil {
+				reason, writeErr = DisconnectClientGone, err
+				return
+			}
+		}
+	}
+}
+
+// newClient resolves the channels and identity of a stream's connection.
+func (s *SSEServer) newClient(st router.Streamer) (*clientConnection, error) {
+	if s.config.ChannelProvider == nil {
+		return nil, &SSEError{Kind: ErrorServer, Status: 500, Message: "channel provider not configured"}
+	}
+	channels, err := s.config.ChannelProvider.ResolveChannels(st)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &clientConnection{
+		id:       newRandomID(),
+		channels: channels,
+		queue:    newSendQueue(s.config.ClientChannelBuffer),
+
+		connectedAt: time.Now(),
+	}
+	if ip, ok := s.config.ChannelProvider.(IdentityProvider); ok {
+		client.key, client.meta = ip.ResolveIdentity(st)
+	}
+	if client.key == "" {
+		client.key = client.id
+	}
+	return client, nil
+}
+
+// probeStream answers a HeaderProbe request with the rejection a stream would
+// get, or 200 with no body. Nothing is registered or consumed: no admission
+// token, presence, hooks or limits.
+func (s *SSEServer) probeStream(st router.Streamer) {
+	if s.admission != nil {
+		if wait := s.admission.pending(); wait > s.config.AdmissionMaxWait {
+			s.reject(st, RateLimited("admission queue full", int((wait+time.Second-1)/time.Second)))
+			return
 		}
 	}
+	client, err := s.newClient(st)
+	if err != nil {
+		s.reject(st, err)
+		return
+	}
+	var limitErr *SSEError
+	s.hub.do(func() { _, limitErr = s.hub.checkLimits(client) })
+	if limitErr != nil {
+		s.reject(st, limitErr)
+		return
+	}
+	st.WriteStatus(200)
+}
+
+// reject writes the status, headers and body for a refused connection.
+// An *SSEError controls all three; any other error maps to 401.
+func (s *SSEServer) reject(st router.Streamer, err error) {
+	var sseErr *SSEError
+	if !errors.As(err, &sseErr) {
+		sseErr = &SSEError{Kind: ErrorUnauthorized, Status: 401, Message: err.Error()}
+	}
+
+	status := sseErr.httpStatus(500)
+	level := LevelWarn
+	if status >= 500 {
+		level = LevelError
+	}
+	s.tinySSE.log(level, LogRejected, "status", status, "kind", sseErr.Kind.String(), "error", sseErr.Message)
+
+	st.SetHeader(ErrorHeader, sseErr.Kind.String())
+	if sseErr.RetryAfter > 0 {
+		st.SetHeader("Retry-After", Convert(sseErr.RetryAfter).String())
+	}
+	st.WriteStatus(status)
+	st.Write([]byte(sseErr.Message + "\n")) //nolint:errcheck
 }
 
 // Publish sends data to a single channel.
+// Rate limit rejections are reported through the logger and metrics only.
 func (s *SSEServer) Publish(data []byte, channel string) {
-	s.hub.broadcast <- &broadcastMessage{
-		msg: &SSEMessage{
-			Event: "", // Default
-			Data:  data,
-		},
-		channels: []string{channel},
-	}
+	s.PublishWith(data, PublishOptions{Channels: []string{channel}}) //nolint:errcheck
 }
 
 // PublishEvent implements SSEPublisher.PublishEvent.
 func (s *SSEServer) PublishEvent(event string, data []byte, channels ...string) {
-	s.hub.broadcast <- &broadcastMessage{
+	s.PublishWith(data, PublishOptions{Event: event, Channels: channels}) //nolint:errcheck
+}
+
+// PublishWith sends data with the given options.
+// Data is stored and delivered in its wire form (see PayloadEncoding).
+// It returns a RateLimited *SSEError when PublishRateLimits rejected the
+// message for some of its channels; the remaining channels still receive it.
+// Direct and anycast messages (PublishOptions.Connection, Anycast) are
+// queued before it returns, or fail with ErrNoRecipient or ErrQueueFull. An invalid
+// PublishOptions.Target is returned as an error and nothing is sent.
+func (s *SSEServer) PublishWith(data []byte, opts PublishOptions) error {
+	_, err := s.publish(data, opts, false)
+	return err
+}
+
+// PublishWithID is PublishWith returning the ID the hub assigned to the
+// message, or the original ID when PublishOptions.IdempotencyKey marks it as
+// a duplicate. The ID is empty when nothing was sent right away (rejected,
+// or held back by RateThrottle).
+func (s *SSEServer) PublishWithID(data []byte, opts PublishOptions) (string, error) {
+	return s.publish(data, opts, true)
+}
+
+// publish suppresses duplicates of opts.IdempotencyKey, then sends.
+func (s *SSEServer) publish(data []byte, opts PublishOptions, wantID bool) (string, error) {
+	if opts.IdempotencyKey == "" {
+		id, _, err := s.send(data, opts, wantID)
+		return id, err
+	}
+	id, duplicate, err := s.idempotency.publish(opts.IdempotencyKey, func() (string, bool, error) {
+		return s.send(data, opts, true)
+	})
+	if duplicate {
+		s.hub.metrics.Add(MetricMessagesDuplicate, 1)
+		s.tinySSE.log(LevelDebug, LogDuplicate, "key", opts.IdempotencyKey, "id", id)
+	}
+	return id, err
+}
+
+// send builds the message and hands it to the hub, waiting for its ID when
+// wantID is set. held reports that RateThrottle holds it back for some
+// channels, to be sent later.
+func (s *SSEServer) send(data []byte, opts PublishOptions, wantID bool) (id string, held bool, err error) {
+	if !validEvent(opts.Event) {
+		return "", false, ErrInvalidEvent
+	}
+	enc := opts.Encoding
+	if enc == EncodingDefault {
+		enc = s.config.PayloadEncoding
+	}
+	bMsg := &broadcastMessage{
 		msg: &SSEMessage{
-			Event: event,
-			Data:  data,
+			Event: opts.Event,
+			Data:  EncodePayload(data, enc),
 		},
-		channels: channels,
+		route: route{
+			channels:  opts.Channels,
+			origin:    opts.Origin,
+			originKey: opts.OriginKey,
+		},
+		key:           opts.Key,
+		conflationKey: opts.ConflationKey,
 	}
+	if opts.TTL > 0 {
+		bMsg.expiresAt = time.Now().Add(opts.TTL)
+	}
+	if opts.Target != "" {
+		target, err := parseTarget(opts.Target)
+		if err != nil {
+			return "", false, err
+		}
+		bMsg.channels, bMsg.target = nil, target
+	}
+	if opts.Connection != "" || opts.Anycast != AnycastNone {
+		// Dispatched synchronously: the ID is set once it returns.
+		if err := s.publishTargeted(bMsg, opts); err != nil {
+			return "", false, err
+		}
+		return bMsg.msg.Id, false, nil
+	}
+	if wantID {
+		bMsg.assigned = make(chan string, 1)
+	}
+
+	sent := true
+	if s.rates != nil {
+		sent, held, err = s.publishLimited(bMsg)
+	} else {
+		s.hub.broadcast <- bMsg
+	}
+	if !sent || !wantID {
+		return "", held, err
+	}
+	return <-bMsg.assigned, held, err
+}
+
+// Subscribe adds channels to an open connection. Cached state of the new
+// channels is delivered immediately. Returns false if connID is not connected.
+func (s *SSEServer) Subscribe(connID string, channels ...string) bool {
+	return s.hub.subscribe(connID, channels)
+}
+
+// Unsubscribe removes channels from an open connection.
+// Returns false if connID is not connected.
+func (s *SSEServer) Unsubscribe(connID string, channels ...string) bool {
+	return s.hub.unsubscribe(connID, channels)
+}
+
+// Connections returns the open connections, oldest first.
+func (s *SSEServer) Connections() []ConnectionInfo {
+	var out []ConnectionInfo
+	s.hub.do(func() {
+		for client := range s.hub.clients {
+			out = append(out, client.info())
+		}
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].ConnectedAt.Before(out[j].ConnectedAt) })
+	return out
+}
+
+// Disconnect closes the connection connID. The client may reconnect.
+// Returns false if connID is not connected.
+func (s *SSEServer) Disconnect(connID string) bool {
+	found := false
+	s.hub.do(func() {
+		if client := s.hub.conns[connID]; client != nil {
+			s.hub.remove(client, DisconnectServerClosed)
+			found = true
+		}
+	})
+	return found
+}
+
+// Presence returns the members currently present in channel, sorted by key.
+// Returns nil if channel is not matched by ServerConfig.PresenceChannels or is empty.
+func (s *SSEServer) Presence(channel string) []*PresenceMember {
+	return s.hub.presenceOf(channel)
+}
+
+// newRandomID returns a random, unguessable identifier for connections and
+// scheduled publishes.
+func newRandomID() string {
+	var b [16]byte
+	rand.Read(b[:]) //nolint:errcheck // crypto/rand never fails on supported platforms
+	return hex.EncodeToString(b[:])
 }
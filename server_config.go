@@ -1,11 +1,96 @@
 package sse
 
+import "time"
+
+// LimitPolicy selects what happens when a connection limit is reached.
+type LimitPolicy uint8
+
+const (
+	// LimitReject refuses the new connection with 429 and Retry-After.
+	LimitReject LimitPolicy = iota
+	// LimitEvictOldest closes the oldest connection of the same identity key
+	// when MaxConnectionsPerKey is reached. Other limits still reject.
+	LimitEvictOldest
+)
+
+// RatePolicy selects what happens to a publish over a PublishRateLimit.
+type RatePolicy uint8
+
+const (
+	// RateReject drops the over-limit channels and makes PublishWith return
+	// a RateLimited error.
+	RateReject RatePolicy = iota
+	// RateDelay blocks the publisher until the message fits the rate.
+	RateDelay
+	// RateThrottle samples latest-wins: an over-limit message is held back and
+	// sent when the rate allows, replaced by any newer one in the meantime.
+	// A Target message cannot be held in part and is rejected instead.
+	RateThrottle
+)
+
+var ratePolicyNames = []string{"reject", "delay", "throttle"}
+
+func (p RatePolicy) String() string {
+	if int(p) < len(ratePolicyNames) {
+		return ratePolicyNames[p]
+	}
+	return "unknown"
+}
+
+// PublishRateLimit limits how fast messages are published to channels.
+// Each matching channel has its own budget.
+type PublishRateLimit struct {
+	// Channels the limit applies to (exact, or prefix when ending in "*").
+	Channels []string
+	// Rate is the sustained number of messages per second per channel.
+	Rate float64
+	// Burst is the number of messages allowed back to back. Default: 1.
+	Burst int
+	// Policy applied over the limit. Default: RateReject.
+	Policy RatePolicy
+	// MaxDelay bounds the wait under RateDelay; publishes that would wait
+	// longer are rejected. 0 = wait as long as needed.
+	MaxDelay time.Duration
+}
+
+// ChannelTTL expires the messages of matching channels.
+type ChannelTTL struct {
+	// Channels the TTL applies to (exact, or prefix when ending in "*").
+	Channels []string
+	// TTL is how long a message stays deliverable after it is published.
+	TTL time.Duration
+}
+
 // ServerConfig holds configuration strictly for the SSE stream handler.
 type ServerConfig struct {
 	// ClientChannelBuffer prevents blocking on slow clients.
 	// Recommended: 10-100.
 	ClientChannelBuffer int
 
+	// BatchMaxBytes enables write batching: everything queued for a client is
+	// coalesced into a single Write and Flush of up to this many bytes.
+	// 0 = one Write and Flush per message.
+	BatchMaxBytes int
+
+	// BatchMaxDelay is the latency budget of a batch: after the first message
+	// the handler waits up to this long for more before flushing.
+	// 0 = flush whatever is already queued. Requires BatchMaxBytes.
+	BatchMaxDelay time.Duration
+
+	// Compression enables gzip or deflate, negotiated per stream from the
+	// request's Accept-Encoding. The encoder is flushed after every write, so
+	// latency is unaffected.
+	Compression bool
+
+	// CompressionLevel is the gzip/deflate level (1-9). 0 = default level.
+	CompressionLevel int
+
+	// CompressionMinBytes sends frames smaller than this many bytes
+	// uncompressed inside the compressed stream: tiny frames grow with the
+	// per-flush overhead. Larger frames are then compressed each on its own,
+	// without earlier frames as dictionary. 0 = compress every frame.
+	CompressionMinBytes int
+
 	// HistoryReplayBuffer manages the "Last-Event-ID" replay history.
 	// Recommended: Depends on message frequency.
 	HistoryReplayBuffer int
@@ -15,8 +100,176 @@ type ServerConfig struct {
 	// Useful for log viewers where clients may connect after events are published.
 	ReplayAllOnConnect bool
 
+	// MessageTTLs expire messages of matching channels (see also
+	// PublishOptions.TTL): once expired, a message is no longer replayed,
+	// sent as cached state, redelivered, or written from a client's queue.
+	// A message to several channels uses the shortest matching TTL; the
+	// first entry matching a channel applies to it.
+	MessageTTLs []ChannelTTL
+
+	// IdempotencyWindow is how long PublishOptions.IdempotencyKey values are
+	// remembered to suppress duplicate publishes. Default: 5m.
+	IdempotencyWindow time.Duration
+
+	// ExpirySweepInterval is how often expired messages are removed from
+	// history, the state cache and reliable tracking. Default: 1m.
+	ExpirySweepInterval time.Duration
+
+	// PayloadEncoding is the default wire encoding of message data.
+	// EncodingAuto base64-encodes payloads that would corrupt the stream
+	// (invalid UTF-8, \r, control characters); clients decode them back.
+	// Default: raw.
+	PayloadEncoding PayloadEncoding
+
+	// StateChannels enables the last-value cache for matching channels
+	// (exact, or prefix when ending in "*"). The latest message per
+	// PublishOptions.Key (default: event name) is sent to every client that
+	// connects or subscribes to the channel, before live traffic.
+	StateChannels []string
+
+	// StateRetention is how long the cached state of a channel is kept once
+	// it has no subscribers and nothing new is published to it. Default: 1h.
+	StateRetention time.Duration
+
+	// MaxConnections limits open connections in total. 0 = unlimited.
+	MaxConnections int
+
+	// MaxConnectionsPerChannel limits subscribers of each channel. 0 = unlimited.
+	MaxConnectionsPerChannel int
+
+	// MaxConnectionsPerKey limits connections per identity key (see
+	// IdentityProvider; without it every connection is its own key).
+	// 0 = unlimited.
+	MaxConnectionsPerKey int
+
+	// LimitPolicy applies when MaxConnectionsPerKey is reached. Default: LimitReject.
+	LimitPolicy LimitPolicy
+
+	// LimitRetryAfter is the Retry-After hint, in seconds, sent with limit
+	// rejections. Default: 5.
+	LimitRetryAfter int
+
+	// AdmissionRate limits how many new streams per second are admitted
+	// (token bucket), so a reconnect storm does not run every
+	// ResolveChannels and history replay at once. 0 = unlimited.
+	AdmissionRate float64
+
+	// AdmissionBurst is the bucket size: attempts admitted back to back
+	// before AdmissionRate applies. Default: 1.
+	AdmissionBurst int
+
+	// AdmissionMaxWait is how long an attempt may be queued for a token.
+	// Beyond it the stream is answered with a "retry:" hint (time until the
+	// queue drains plus jitter) and closed. 0 = never queue.
+	AdmissionMaxWait time.Duration
+
+	// AdmissionJitter is the upper bound of the random delay added to the
+	// retry hint, spreading reconnects out. Default: 1s.
+	AdmissionJitter time.Duration
+
+	// ReliableChannels enables acknowledged, at-least-once delivery for
+	// matching channels (exact, or prefix when ending in "*"). Messages stay
+	// pending per identity key (see IdentityProvider) until a client of that
+	// key acknowledges them through AckHandler, and are redelivered on
+	// reconnect and every ReliableRedeliverAfter. Clients deduplicate by ID.
+	// Requires an IdentityProvider: connections without an identity key are
+	// not tracked, as their reconnects could never acknowledge anything.
+	// SSEClient only sees, and so acknowledges, unnamed events: publish to
+	// these channels without PublishOptions.Event.
+	ReliableChannels []string
+
+	// ReliableMaxPending caps the unacknowledged messages kept per identity
+	// key; the oldest are dropped beyond it. Default: 100.
+	ReliableMaxPending int
+
+	// ReliableRedeliverAfter is how long a message may stay unacknowledged
+	// before it is sent again to the open connections of its key. Default: 30s.
+	ReliableRedeliverAfter time.Duration
+
+	// ReliableRetention is how long pending messages of an identity without
+	// open connections are kept. Default: 10m.
+	ReliableRetention time.Duration
+
+	// InboxChannels enables a durable inbox for matching channels (exact, or
+	// prefix when ending in "*", e.g. "user:*"). Messages published to such a
+	// channel while it has no subscriber are stored in InboxStore and
+	// delivered to the next connection subscribing to it.
+	InboxChannels []string
+
+	// InboxMaxMessages caps the messages stored per channel; the oldest are
+	// dropped beyond it. Default: 100.
+	InboxMaxMessages int
+
+	// InboxTTL is how long a stored message waits for a recipient before it
+	// expires. Default: 24h.
+	InboxTTL time.Duration
+
+	// InboxStore persists the inbox. Default: an in-memory store (see NewMemoryInbox).
+	InboxStore InboxStore
+
+	// ScheduleStore persists publishes scheduled with SSEServer.PublishAt and
+	// PublishAfter across restarts. nil = they live in memory only.
+	ScheduleStore ScheduleStore
+
+	// PublishRateLimits limits the publish rate of matching channels, so a
+	// runaway producer cannot flood every subscriber. The first limit whose
+	// Channels match a channel applies. A PublishOptions.Target message uses
+	// the budgets of every channel it names and is sent whole or not at all.
+	PublishRateLimits []PublishRateLimit
+
 	// ChannelProvider resolves channels for each SSE connection.
 	// If nil, a default provider is used that rejects all connections
 	// with error "channel provider not configured".
 	ChannelProvider ChannelProvider
+
+	// PresenceChannels enables presence tracking for matching channels.
+	// Entries match exactly, or by prefix when they end in "*" (e.g. "room:*").
+	// Members are identified by IdentityProvider when the ChannelProvider
+	// implements it, otherwise each connection is its own member.
+	PresenceChannels []string
+
+	// PresenceEvents broadcasts "presence.join" and "presence.leave" events
+	// (JSON-encoded PresenceMember) to tracked channels.
+	PresenceEvents bool
+
+	// PresenceDebounce delays leave events so a member that reconnects within
+	// the window emits neither leave nor join. 0 = leave immediately.
+	PresenceDebounce time.Duration
+
+	// Metrics receives counters and gauges (see Metric* constants).
+	// Use NewMetricsRegistry for a Prometheus-compatible in-memory registry.
+	// If nil, metrics are disabled.
+	Metrics Metrics
+
+	// Lifecycle hooks. All are optional and must not block for long.
+	//
+	// OnConnect and OnDisconnect run on the connection's own goroutine:
+	// OnConnect after the client is registered and before any message
+	// (including replay) is written; OnDisconnect exactly once after the
+	// client is unregistered, with a Disconnect* reason.
+	OnConnect    func(conn ConnectionInfo)
+	OnDisconnect func(conn ConnectionInfo, reason string)
+
+	// OnPublish runs on the hub goroutine after the message ID is assigned
+	// and before fan-out, in publish order. It must not call back into the
+	// server (e.g. Publish), which would deadlock.
+	OnPublish func(msg *SSEMessage, channels []string)
+
+	// OnReceive handles messages a client sends upstream (SSEClient.Send,
+	// served by SSEServer.ReceiveHandler) with the sender's connection. It
+	// runs on the request's goroutine. A returned *SSEError sets the response
+	// status; any other error maps to 400.
+	OnReceive func(conn ConnectionInfo, msg *SSEMessage) error
+
+	// OnCall handles calls a client makes (SSEClient.Call, served by
+	// SSEServer.CallHandler). call.Id is the correlation ID, call.Event the
+	// method and call.Data the arguments. It runs on the request's goroutine
+	// and should start the work and return; the result is sent later with
+	// SSEServer.Reply or ReplyError. A returned error rejects the call: an
+	// *SSEError sets the response status, any other error maps to 400.
+	OnCall func(conn ConnectionInfo, call *SSEMessage) error
+
+	// OnDeliver runs on the connection's goroutine after each message is
+	// written and flushed, in delivery order for that connection.
+	OnDeliver func(conn ConnectionInfo, msg *SSEMessage)
 }
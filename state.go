@@ -0,0 +1,75 @@
+//go:build !wasm
+
+package sse
+
+import (
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// defaultStateRetention is used when ServerConfig.StateRetention is 0.
+const defaultStateRetention = time.Hour
+
+// cacheState stores bMsg as the latest value of its key in every state channel
+// it is published to. Must run on the hub goroutine.
+func (h *hub) cacheState(bMsg *broadcastMessage) {
+	key := bMsg.key
+	if key == "" {
+		key = bMsg.msg.Event
+	}
+	for _, ch := range bMsg.channels {
+		if !matchAnyChannel(h.config.StateChannels, ch) {
+			continue
+		}
+		entries := h.state[ch]
+		if entries == nil {
+			entries = make(map[string]*historyItem)
+			h.state[ch] = entries
+		}
+		entries[key] = &historyItem{msg: bMsg.msg, expiresAt: bMsg.expiresAt}
+		h.stateActive[ch] = time.Now()
+		h.startSweeper()
+	}
+}
+
+// collectState adds the cached state of channels to cu. Expired messages, or
+// already seen according to lastEventID, are left out. When force is false
+// a full queue drops the state like live traffic.
+// Must run on the hub goroutine.
+func (h *hub) collectState(cu *catchUp, channels []string, lastEventID string, force bool) {
+	now := time.Now()
+	for _, ch := range channels {
+		for _, item := range h.state[ch] {
+			if idAfter(item.msg.Id, lastEventID) && !expired(item.expiresAt, now) {
+				cu.add(item.outbound(), force)
+			}
+		}
+	}
+}
+
+// sweepState forgets the state of channels without subscribers once nothing
+// was published to them for StateRetention. Must run on the hub goroutine.
+func (h *hub) sweepState(now time.Time) {
+	retention := h.config.StateRetention
+	if retention <= 0 {
+		retention = defaultStateRetention
+	}
+	for ch, at := range h.stateActive {
+		if h.subscribers[ch] == 0 && now.Sub(at) >= retention {
+			delete(h.state, ch)
+			delete(h.stateActive, ch)
+		}
+	}
+}
+
+// idAfter reports whether message id was assigned after lastID.
+// An empty or non-numeric lastID is before every id.
+func idAfter(id, lastID string) bool {
+	last, err := Convert(lastID).Int64()
+	if lastID == "" || err != nil {
+		return true
+	}
+	n, _ := Convert(id).Int64()
+	return n > last
+}
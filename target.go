@@ -0,0 +1,154 @@
+//go:build !wasm
+
+package sse
+
+import . "github.com/tinywasm/fmt"
+
+// channelExpr is a parsed PublishOptions.Target, evaluated against the
+// channel set of each connection.
+type channelExpr interface {
+	match(channels []string) bool
+	// reach returns the channels a matching connection is reached through,
+	// i.e. all named channels except the excluded side of '-'.
+	reach() []string
+	String() string
+}
+
+// exprChannel is true for connections subscribed to the channel.
+type exprChannel string
+
+func (e exprChannel) match(channels []string) bool { return containsString(channels, string(e)) }
+func (e exprChannel) reach() []string              { return []string{string(e)} }
+func (e exprChannel) String() string               { return string(e) }
+
+// exprOp combines two expressions with '&', '-' or '|'.
+type exprOp struct {
+	op          byte
+	left, right channelExpr
+}
+
+func (e *exprOp) match(channels []string) bool {
+	switch e.op {
+	case '&':
+		return e.left.match(channels) && e.right.match(channels)
+	case '-':
+		return e.left.match(channels) && !e.right.match(channels)
+	}
+	return e.left.match(channels) || e.right.match(channels)
+}
+
+func (e *exprOp) reach() []string {
+	if e.op == '-' {
+		return e.left.reach()
+	}
+	return append(e.left.reach(), e.right.reach()...)
+}
+
+func (e *exprOp) String() string {
+	return "(" + e.left.String() + " " + string(e.op) + " " + e.right.String() + ")"
+}
+
+// parseTarget parses a channel set expression:
+//
+//	a & b    connections in both a and b
+//	a - b    connections in a but not in b
+//	a | b    connections in a or b (same as listing both in Channels)
+//
+// '&' binds tighter than '-', which binds tighter than '|'; operators of the
+// same kind group left to right, and parentheses override. '-' must be
+// separated by spaces, since channel names may contain it.
+func parseTarget(s string) (channelExpr, error) {
+	p := &targetParser{tokens: tokenizeTarget(s)}
+	expr, err := p.union()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, Err("invalid target: unexpected " + p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+// tokenizeTarget splits s into names and the tokens & | ( ) -.
+func tokenizeTarget(s string) []string {
+	var tokens []string
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, s[start:end])
+			start = -1
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n', '\r':
+			flush(i)
+		case '&', '|', '(', ')':
+			flush(i)
+			tokens = append(tokens, string(c))
+		default:
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	flush(len(s))
+	return tokens
+}
+
+type targetParser struct {
+	tokens []string
+	pos    int
+}
+
+// binary parses operands joined by op, left to right.
+func (p *targetParser) binary(op string, operand func() (channelExpr, error)) (channelExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.tokens) && p.tokens[p.pos] == op {
+		p.pos++
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprOp{op: op[0], left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *targetParser) union() (channelExpr, error) {
+	return p.binary("|", p.difference)
+}
+
+func (p *targetParser) difference() (channelExpr, error) {
+	return p.binary("-", p.intersection)
+}
+
+func (p *targetParser) intersection() (channelExpr, error) {
+	return p.binary("&", p.operand)
+}
+
+func (p *targetParser) operand() (channelExpr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, Err("invalid target: channel expected at end")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	switch tok {
+	case "(":
+		expr, err := p.union()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos] != ")" {
+			return nil, Err("invalid target: missing )")
+		}
+		p.pos++
+		return expr, nil
+	case ")", "&", "|", "-":
+		return nil, Err("invalid target: channel expected, got " + tok)
+	}
+	return exprChannel(tok), nil
+}
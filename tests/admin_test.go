@@ -0,0 +1,146 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// request is a router.Context with a path and a request body.
+type request struct {
+	*mockStreamer
+	path string
+	body string
+}
+
+func newRequest(path, body string) *request {
+	r := &request{mockStreamer: newMockStreamer(), path: path, body: body}
+	r.SetHeader("X-Admin", "yes")
+	return r
+}
+
+func (r *request) Path() string          { return r.path }
+func (r *request) Body() ([]byte, error) { return []byte(r.body), nil }
+
+func adminAuth(ctx router.Context) error {
+	if ctx.GetHeader("X-Admin") != "yes" {
+		return Unauthorized("admin only")
+	}
+	return nil
+}
+
+func newAdminServer(t *testing.T) (*SSEServer, *AdminAPI) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"all", "room:1"}}},
+	})
+	return server, server.Admin(adminAuth)
+}
+
+func TestAdminRequiresAuth(t *testing.T) {
+	_, admin := newAdminServer(t)
+
+	req := newRequest("/sse/admin/stats", "")
+	req.SetHeader("X-Admin", "")
+	admin.Stats()(req)
+	if req.Status != 401 || !Contains(req.Output(), `"error":"admin only"`) {
+		t.Errorf("expected 401 JSON error, got %d %s", req.Status, req.Output())
+	}
+
+	server, _ := newAdminServer(t)
+	req = newRequest("/sse/admin/stats", "")
+	server.Admin(nil).Stats()(req)
+	if req.Status != 403 {
+		t.Errorf("nil auth must reject, got %d", req.Status)
+	}
+}
+
+func TestAdminInspectsHub(t *testing.T) {
+	server, admin := newAdminServer(t)
+	connectAs(server, "alice")
+	connectAs(server, "bob")
+	server.PublishEvent("note", []byte("hello"), "room:1")
+	last := publishID(t, server, "everyone", "all")
+	time.Sleep(30 * time.Millisecond)
+
+	req := newRequest("/sse/admin/connections", "")
+	admin.Connections()(req)
+	out := req.Output()
+	if req.Status != 200 || req.GetHeader("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %q", req.Status, req.GetHeader("Content-Type"))
+	}
+	if Index(out, `"key":"alice"`) < 0 || Index(out, `"key":"alice"`) > Index(out, `"key":"bob"`) {
+		t.Errorf("expected alice then bob, got %s", out)
+	}
+	if !Contains(out, `"channels":"all,room:1"`) {
+		t.Errorf("expected channels, got %s", out)
+	}
+
+	req = newRequest("/sse/admin/channels", "")
+	admin.Channels()(req)
+	if want := `{"channels":[{"name":"all","subscribers":2},{"name":"room:1","subscribers":2}]}`; req.Output() != want {
+		t.Errorf("expected %s, got %s", want, req.Output())
+	}
+
+	req = newRequest("/sse/admin/history/room:1", "")
+	admin.History()(req)
+	if out := req.Output(); Count(out, `"id"`) != 1 || !Contains(out, `"event":"note"`) {
+		t.Errorf("expected the room:1 message only, got %s", out)
+	}
+
+	req = newRequest("/sse/admin/stats", "")
+	admin.Stats()(req)
+	for _, want := range []string{`"connections":2`, `"channels":2`, `"history":2`, `"last_id":"` + last + `"`} {
+		if !Contains(req.Output(), want) {
+			t.Errorf("expected %s in %s", want, req.Output())
+		}
+	}
+}
+
+func TestAdminPublishAndDisconnect(t *testing.T) {
+	server, admin := newAdminServer(t)
+	st := connectAs(server, "alice")
+
+	req := newRequest("/sse/admin/publish", `{"event":"test","channels":"all, room:1","data":"ping"}`)
+	req.SetHeader("Content-Type", "application/json")
+	admin.Publish()(req)
+	if req.Status != 204 {
+		t.Fatalf("expected 204, got %d %s", req.Status, req.Output())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if Count(st.Output(), "event: test\ndata: ping") != 1 {
+		t.Errorf("expected the test event once, got %q", st.Output())
+	}
+
+	req = newRequest("/sse/admin/publish", `{"data":"ping"}`)
+	admin.Publish()(req)
+	if req.Status != 400 {
+		t.Errorf("expected 400 without channels, got %d", req.Status)
+	}
+
+	conns := server.Connections()
+	if len(conns) != 1 {
+		t.Fatalf("expected 1 connection, got %d", len(conns))
+	}
+	req = newRequest("/sse/admin/disconnect", `{"id":"`+conns[0].ID+`"}`)
+	admin.Disconnect()(req)
+	if req.Status != 204 {
+		t.Fatalf("expected 204, got %d %s", req.Status, req.Output())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(server.Connections()) != 0 {
+		t.Error("expected the connection to be closed")
+	}
+
+	req = newRequest("/sse/admin/disconnect", `{"id":"`+conns[0].ID+`"}`)
+	admin.Disconnect()(req)
+	if req.Status != 404 {
+		t.Errorf("expected 404 for an unknown connection, got %d", req.Status)
+	}
+}
@@ -0,0 +1,92 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// countingProvider counts ResolveChannels calls.
+type countingProvider struct {
+	mockChannelProvider
+	calls atomic.Int32
+}
+
+func (p *countingProvider) ResolveChannels(ctx router.Context) ([]string, error) {
+	p.calls.Add(1)
+	return p.mockChannelProvider.ResolveChannels(ctx)
+}
+
+func TestAdmissionThrottlesWithRetryHint(t *testing.T) {
+	provider := &countingProvider{mockChannelProvider: mockChannelProvider{channels: []string{"all"}}}
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     provider,
+		Metrics:             reg,
+		AdmissionRate:       1,
+		AdmissionBurst:      2,
+		AdmissionJitter:     500 * time.Millisecond,
+	})
+
+	connectAs(server, "a")
+	connectAs(server, "b")
+
+	st := newMockStreamer()
+	server.StreamHandler()(st) // throttled: returns immediately
+
+	if provider.calls.Load() != 2 {
+		t.Errorf("throttled attempt must not resolve channels, got %d calls", provider.calls.Load())
+	}
+	if st.Status != 200 || st.GetHeader("Content-Type") != "text/event-stream" {
+		t.Errorf("expected an event stream, got %d %q", st.Status, st.GetHeader("Content-Type"))
+	}
+	out := st.Output()
+	if !HasPrefix(out, "retry: ") || !HasSuffix(out, "\n\n") {
+		t.Fatalf("expected a retry hint, got %q", out)
+	}
+	retry, err := Convert(TrimSpace(TrimPrefix(out, "retry: "))).Int()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ~1s until the next token, plus up to 500ms of jitter.
+	if retry < 800 || retry >= 1500 {
+		t.Errorf("retry hint %dms outside the expected range", retry)
+	}
+	if reg.Value(MetricConnectionsThrottled) != 1 {
+		t.Errorf("expected 1 throttled connection, got %v", reg.Value(MetricConnectionsThrottled))
+	}
+}
+
+func TestAdmissionQueuesWithinMaxWait(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+		Metrics:             reg,
+		AdmissionRate:       10,
+		AdmissionMaxWait:    time.Second,
+	})
+
+	streams := make([]*mockStreamer, 3)
+	for i := range streams {
+		streams[i] = newMockStreamer()
+		go server.StreamHandler()(streams[i])
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	for i, st := range streams {
+		if st.FlushCount() == 0 || Contains(st.Output(), "retry:") {
+			t.Errorf("stream %d: expected to be admitted after queueing", i)
+		}
+	}
+	if reg.Value(MetricConnectionsQueued) != 2 {
+		t.Errorf("expected 2 queued connections, got %v", reg.Value(MetricConnectionsQueued))
+	}
+}
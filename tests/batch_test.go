@@ -0,0 +1,88 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// burst blocks st inside the write of a first message, publishes n more while
+// it is stuck and then lets it drain. Returns the flushes after the header flush.
+func burst(server *SSEServer, st *mockStreamer, n int) int {
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+
+	st.Pause()
+	server.Publish([]byte("first"), "burst")
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < n; i++ {
+		server.Publish([]byte("mm"), "burst")
+	}
+	time.Sleep(20 * time.Millisecond)
+	st.Resume()
+	time.Sleep(50 * time.Millisecond)
+	return st.FlushCount() - 1
+}
+
+func TestBatchingCoalescesBurst(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		maxBytes int
+		flushes  int
+	}{
+		{"disabled", 0, 1 + 20},
+		{"unbounded", 4096, 1 + 1},
+	} {
+		server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+			ClientChannelBuffer: 100,
+			BatchMaxBytes:       c.maxBytes,
+			ChannelProvider:     &mockChannelProvider{channels: []string{"burst"}},
+		})
+		st := newMockStreamer()
+		if got := burst(server, st, 20); got != c.flushes {
+			t.Errorf("%s: expected %d flushes, got %d", c.name, c.flushes, got)
+		}
+		if n := Count(st.Output(), "data: mm"); n != 20 {
+			t.Errorf("%s: expected 20 messages, got %d", c.name, n)
+		}
+	}
+}
+
+func TestBatchingRespectsByteBudget(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 100,
+		BatchMaxBytes:       62, // two frames of "id: <16 digits>\ndata: mm\n\n" (31 bytes)
+		ChannelProvider:     &mockChannelProvider{channels: []string{"burst"}},
+	})
+
+	st := newMockStreamer()
+	if got := burst(server, st, 10); got != 1+5 {
+		t.Errorf("expected 6 flushes (first + 5 pairs), got %d", got)
+	}
+}
+
+func TestBatchingLatencyBudget(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 100,
+		BatchMaxBytes:       4096,
+		BatchMaxDelay:       50 * time.Millisecond,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"burst"}},
+	})
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		server.Publish([]byte("mm"), "burst")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if got := st.FlushCount(); got != 2 {
+		t.Errorf("expected header flush + 1 batch flush, got %d", got)
+	}
+}
@@ -6,11 +6,20 @@ import (
 	. "github.com/tinywasm/sse"
 	"syscall/js"
 	"testing"
+	"time"
 )
 
 // This test requires `wasmbrowsertest` or a similar environment.
 // If running in standard `go test`, it will be skipped by build tag.
 
+// addEventListenerMock stores listeners registered on obj as obj["listener:<event>"].
+func addEventListenerMock(obj js.Value) {
+	obj.Set("addEventListener", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		obj.Set("listener:"+args[0].String(), args[1])
+		return nil
+	}))
+}
+
 func TestClientConnect(t *testing.T) {
 	// We cannot easily spin up a real server in WASM environment.
 	// Tests here typically verify JS interop or logic that doesn't require network
@@ -29,6 +38,7 @@ func TestClientConnect(t *testing.T) {
 		obj := js.Global().Get("Object").New()
 		obj.Set("readyState", 0)
 		obj.Set("close", js.FuncOf(func(this js.Value, args []js.Value) interface{} { return nil }))
+		addEventListenerMock(obj)
 		return obj
 	}))
 
@@ -56,6 +66,7 @@ func TestClientOnMessage(t *testing.T) {
 		obj := js.Global().Get("Object").New()
 		obj.Set("readyState", 0)
 		obj.Set("close", js.FuncOf(func(this js.Value, args []js.Value) interface{} { return nil }))
+		addEventListenerMock(obj)
 
 		esInstance = obj
 		return obj
@@ -99,3 +110,328 @@ func TestClientOnMessage(t *testing.T) {
 		t.Errorf("expected ID '123', got %s", received.Id)
 	}
 }
+
+func TestClientDecodesEncodedPayload(t *testing.T) {
+	var esInstance js.Value
+	js.Global().Set("EventSource", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		obj := js.Global().Get("Object").New()
+		obj.Set("readyState", 0)
+		obj.Set("close", js.FuncOf(func(this js.Value, args []js.Value) interface{} { return nil }))
+		addEventListenerMock(obj)
+		esInstance = obj
+		return obj
+	}))
+
+	client := New(&Config{}).Client(&ClientConfig{Endpoint: "/bin"})
+	var received *SSEMessage
+	client.OnMessage(func(msg *SSEMessage) { received = msg })
+	client.Connect()
+
+	binary := []byte{0x00, '\r', 0xff}
+	event := js.Global().Get("Object").New()
+	event.Set("data", MarkerBase64+"AA3/") // base64 of binary
+	event.Set("lastEventId", "1")
+	event.Set("type", "message")
+	esInstance.Get("onmessage").Invoke(event)
+
+	if received == nil {
+		t.Fatal("handler not called")
+	}
+	verifyMessage(t, received, "message", binary)
+}
+
+func TestClientOnErrorClassifiesRejection(t *testing.T) {
+	var esInstance js.Value
+	js.Global().Set("EventSource", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		obj := js.Global().Get("Object").New()
+		obj.Set("readyState", 2) // CLOSED: the browser gave up
+		obj.Set("close", js.FuncOf(func(this js.Value, args []js.Value) interface{} { return nil }))
+		addEventListenerMock(obj)
+		esInstance = obj
+		return obj
+	}))
+
+	// Mock fetch: the probe sees a 429 with Retry-After.
+	promise := js.Global().Get("Promise")
+	js.Global().Set("fetch", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		headers := map[string]interface{}{ErrorHeader: "rate_limited", "Retry-After": "7"}
+		resp := js.Global().Get("Object").New()
+		resp.Set("status", 429)
+		h := js.Global().Get("Object").New()
+		h.Set("get", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			if v, ok := headers[args[0].String()]; ok {
+				return v
+			}
+			return js.Null()
+		}))
+		resp.Set("headers", h)
+		resp.Set("text", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return promise.Call("resolve", "too many connections\n")
+		}))
+		return promise.Call("resolve", resp)
+	}))
+
+	client := New(&Config{}).Client(&ClientConfig{Endpoint: "/events", RetryInterval: 1000})
+	errs := make(chan error, 1)
+	client.OnError(func(err error) { errs <- err })
+	client.Connect()
+
+	esInstance.Get("onerror").Invoke(js.Global().Get("Object").New())
+
+	select {
+	case err := <-errs:
+		sseErr, ok := err.(*SSEError)
+		if !ok {
+			t.Fatalf("expected *SSEError, got %T", err)
+		}
+		if sseErr.Kind != ErrorRateLimited || sseErr.Status != 429 || sseErr.RetryAfter != 7 {
+			t.Errorf("unexpected error: %+v", sseErr)
+		}
+		if sseErr.Message != "too many connections" {
+			t.Errorf("unexpected message %q", sseErr.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnError not called")
+	}
+	client.Close()
+}
+
+func TestClientStopsOnEviction(t *testing.T) {
+	var esInstance js.Value
+	var closed bool
+	js.Global().Set("EventSource", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		obj := js.Global().Get("Object").New()
+		obj.Set("readyState", 1)
+		obj.Set("close", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			closed = true
+			return nil
+		}))
+		addEventListenerMock(obj)
+		esInstance = obj
+		return obj
+	}))
+
+	client := New(&Config{}).Client(&ClientConfig{Endpoint: "/events"})
+	var got error
+	client.OnError(func(err error) { got = err })
+	client.Connect()
+
+	esInstance.Get("listener:" + EvictedEvent).Invoke(js.Global().Get("Object").New())
+
+	if !closed {
+		t.Error("expected the stream to be closed")
+	}
+	if sseErr, ok := got.(*SSEError); !ok || sseErr.Kind != ErrorEvicted {
+		t.Errorf("expected ErrorEvicted, got %v", got)
+	}
+}
+
+func TestClientSendPostsWithConnectionID(t *testing.T) {
+	var esInstance js.Value
+	js.Global().Set("EventSource", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		obj := js.Global().Get("Object").New()
+		obj.Set("readyState", 1)
+		obj.Set("close", js.FuncOf(func(this js.Value, args []js.Value) interface{} { return nil }))
+		addEventListenerMock(obj)
+		esInstance = obj
+		return obj
+	}))
+
+	type sent struct {
+		url, method, conn, event string
+		body                     []byte
+	}
+	requests := make(chan sent, 1)
+	promise := js.Global().Get("Promise")
+	js.Global().Set("fetch", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		opts := args[1]
+		body := make([]byte, opts.Get("body").Get("length").Int())
+		js.CopyBytesToGo(body, opts.Get("body"))
+		headers := opts.Get("headers")
+		requests <- sent{
+			url:    args[0].String(),
+			method: opts.Get("method").String(),
+			conn:   headers.Get(HeaderConnection).String(),
+			event:  headers.Get(HeaderPublishEvent).String(),
+			body:   body,
+		}
+		resp := js.Global().Get("Object").New()
+		resp.Set("ok", true)
+		return promise.Call("resolve", resp)
+	}))
+
+	client := New(&Config{}).Client(&ClientConfig{Endpoint: "/events", SendEndpoint: "/events/send"})
+	client.Connect()
+
+	if err := client.Send("typing", []byte("hi")); err == nil {
+		t.Error("expected an error before the connection ID is known")
+	}
+
+	connected := js.Global().Get("Object").New()
+	connected.Set("data", "abc123")
+	esInstance.Get("listener:" + ConnectedEvent).Invoke(connected)
+	if client.ConnectionID() != "abc123" {
+		t.Fatalf("expected connection ID abc123, got %q", client.ConnectionID())
+	}
+
+	if err := client.Send("typing", []byte{0x00, 'h', 'i'}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-requests:
+		if req.url != "/events/send" || req.method != "POST" || req.conn != "abc123" || req.event != "typing" {
+			t.Errorf("unexpected request %+v", req)
+		}
+		if string(req.body) != "\x00hi" {
+			t.Errorf("unexpected body %q", req.body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fetch not called")
+	}
+
+	client.Close()
+	if client.ConnectionID() != "" {
+		t.Error("expected the connection ID to be cleared on Close")
+	}
+}
+
+func TestClientReliableModeDedupesAndAcks(t *testing.T) {
+	var esInstance js.Value
+	js.Global().Set("EventSource", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		obj := js.Global().Get("Object").New()
+		obj.Set("readyState", 1)
+		obj.Set("close", js.FuncOf(func(this js.Value, args []js.Value) interface{} { return nil }))
+		addEventListenerMock(obj)
+		esInstance = obj
+		return obj
+	}))
+
+	acks := make(chan string, 4)
+	promise := js.Global().Get("Promise")
+	js.Global().Set("fetch", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		body := make([]byte, args[1].Get("body").Get("length").Int())
+		js.CopyBytesToGo(body, args[1].Get("body"))
+		acks <- args[0].String() + " " + args[1].Get("headers").Get(HeaderConnection).String() + " " + string(body)
+		resp := js.Global().Get("Object").New()
+		resp.Set("ok", true)
+		return promise.Call("resolve", resp)
+	}))
+
+	client := New(&Config{}).Client(&ClientConfig{Endpoint: "/events", AckEndpoint: "/events/ack", AckInterval: 10})
+	var handled []string
+	client.OnMessage(func(msg *SSEMessage) { handled = append(handled, msg.Id) })
+	client.Connect()
+
+	connected := js.Global().Get("Object").New()
+	connected.Set("data", "conn1")
+	esInstance.Get("listener:" + ConnectedEvent).Invoke(connected)
+
+	for _, id := range []string{"5", "6", "5"} { // 5 is redelivered
+		event := js.Global().Get("Object").New()
+		event.Set("data", "x")
+		event.Set("lastEventId", id)
+		event.Set("type", "message")
+		esInstance.Get("onmessage").Invoke(event)
+	}
+
+	if len(handled) != 2 || handled[0] != "5" || handled[1] != "6" {
+		t.Errorf("expected 5 and 6 handled once each, got %v", handled)
+	}
+	select {
+	case ack := <-acks:
+		if ack != "/events/ack conn1 5,6,5" {
+			t.Errorf("unexpected ack %q", ack)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acks not sent")
+	}
+	client.Close()
+}
+
+func TestClientCallResolvesFromReply(t *testing.T) {
+	var esInstance js.Value
+	js.Global().Set("EventSource", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		obj := js.Global().Get("Object").New()
+		obj.Set("readyState", 1)
+		obj.Set("close", js.FuncOf(func(this js.Value, args []js.Value) interface{} { return nil }))
+		addEventListenerMock(obj)
+		esInstance = obj
+		return obj
+	}))
+
+	callIDs := make(chan string, 4)
+	promise := js.Global().Get("Promise")
+	js.Global().Set("fetch", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		headers := args[1].Get("headers")
+		callIDs <- headers.Get(HeaderPublishEvent).String() + "#" + headers.Get(HeaderCall).String()
+		resp := js.Global().Get("Object").New()
+		resp.Set("ok", true)
+		return promise.Call("resolve", resp)
+	}))
+
+	client := New(&Config{}).Client(&ClientConfig{Endpoint: "/events", CallEndpoint: "/events/call", CallTimeout: 20})
+	client.Connect()
+	connected := js.Global().Get("Object").New()
+	connected.Set("data", "abc123")
+	esInstance.Get("listener:" + ConnectedEvent).Invoke(connected)
+
+	type result struct {
+		reply *SSEMessage
+		err   error
+	}
+	results := make(chan result, 4)
+	done := func(reply *SSEMessage, err error) { results <- result{reply, err} }
+	kindOf := func(err error) ErrorKind {
+		if sseErr, ok := err.(*SSEError); ok {
+			return sseErr.Kind
+		}
+		return 255
+	}
+
+	reply := func(data string) {
+		event := js.Global().Get("Object").New()
+		event.Set("data", data)
+		esInstance.Get("listener:" + ReplyEvent).Invoke(event)
+	}
+
+	client.Call("job.start", []byte("args"), done)
+	if id := <-callIDs; id != "job.start#1" {
+		t.Fatalf("unexpected call %q", id)
+	}
+	reply("1\n\nresult")
+	if r := <-results; r.err != nil || r.reply.Id != "1" || r.reply.Event != "job.start" || string(r.reply.Data) != "result" {
+		t.Errorf("unexpected result %+v", r)
+	}
+
+	client.Call("job.start", nil, done)
+	reply("2\nforbidden\nnot yours")
+	if r := <-results; kindOf(r.err) != ErrorForbidden {
+		t.Errorf("expected a forbidden error, got %v", r.err)
+	}
+
+	cancel := client.Call("job.start", nil, done)
+	cancel()
+	if r := <-results; kindOf(r.err) != ErrorCanceled {
+		t.Errorf("expected a canceled error, got %v", r.err)
+	}
+	reply("3\n\nlate") // ignored after cancellation
+
+	client.Call("job.slow", nil, done)
+	select {
+	case r := <-results:
+		if kindOf(r.err) != ErrorTimeout {
+			t.Errorf("expected a timeout, got %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("call did not time out")
+	}
+
+	client.Call("job.start", nil, done)
+	client.Close()
+	if r := <-results; kindOf(r.err) != ErrorConnection {
+		t.Errorf("expected pending calls to fail on close, got %v", r.err)
+	}
+	if len(results) != 0 {
+		t.Errorf("calls resolved more than once: %d extra results", len(results))
+	}
+}
@@ -0,0 +1,117 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	. "github.com/tinywasm/sse"
+	"io"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestCompressionNegotiation(t *testing.T) {
+	cases := []struct {
+		accept   string
+		config   ServerConfig
+		encoding string
+	}{
+		{"gzip, deflate", ServerConfig{Compression: true}, "gzip"},
+		{"deflate", ServerConfig{Compression: true}, "deflate"},
+		{"gzip;q=0, deflate;q=0.5", ServerConfig{Compression: true}, "deflate"},
+		{"br", ServerConfig{Compression: true}, ""},
+		{"gzip", ServerConfig{}, ""},
+		{"gzip", ServerConfig{Compression: true, CompressionMinBytes: 1000}, "gzip"}, // small frames stored
+		{"gzip;q=0, *", ServerConfig{Compression: true}, "deflate"},
+		{"*", ServerConfig{Compression: true}, "gzip"},
+		{"gzip;q=0, deflate;q=0, *", ServerConfig{Compression: true}, ""},
+	}
+
+	for _, c := range cases {
+		cfg := c.config
+		cfg.ClientChannelBuffer = 10
+		cfg.ChannelProvider = &mockChannelProvider{channels: []string{"logs"}}
+		server := New(&Config{Log: testLog(t)}).Server(&cfg)
+
+		st := newMockStreamer()
+		st.SetHeader("Accept-Encoding", c.accept)
+		go server.StreamHandler()(st)
+		time.Sleep(30 * time.Millisecond)
+
+		server.PublishEvent("line", []byte("compressible compressible compressible"), "logs")
+		time.Sleep(30 * time.Millisecond)
+
+		if got := st.GetHeader("Content-Encoding"); got != c.encoding {
+			t.Errorf("%q: expected encoding %q, got %q", c.accept, c.encoding, got)
+			continue
+		}
+
+		body := []byte(st.Output())
+		var r io.Reader
+		switch c.encoding {
+		case "gzip":
+			r, _ = gzip.NewReader(bytes.NewReader(body))
+		case "deflate":
+			r, _ = zlib.NewReader(bytes.NewReader(body))
+		}
+		if r != nil {
+			// The stream is still open: expect data followed by an unexpected EOF.
+			body, _ = io.ReadAll(r)
+		}
+		if !Contains(string(body), "data: compressible compressible compressible") {
+			t.Errorf("%q: message not readable after decoding: %q", c.accept, body)
+		}
+	}
+}
+
+func TestCompressionMinBytesPerFrame(t *testing.T) {
+	for _, accept := range []string{"gzip", "deflate"} {
+		server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+			ClientChannelBuffer: 10,
+			Compression:         true,
+			CompressionMinBytes: 64,
+			ChannelProvider:     &mockChannelProvider{channels: []string{"logs"}},
+		})
+		st := newMockStreamer()
+		st.SetHeader("Accept-Encoding", accept)
+		done := make(chan struct{})
+		go func() {
+			server.StreamHandler()(st)
+			close(done)
+		}()
+		time.Sleep(30 * time.Millisecond)
+
+		large := Convert("compressible ").Repeat(40).String()
+		server.PublishEvent("line", []byte("tiny"), "logs")
+		server.PublishEvent("line", []byte(large), "logs")
+		server.PublishEvent("line", []byte("tiny again"), "logs")
+		time.Sleep(30 * time.Millisecond)
+		server.Disconnect(server.Connections()[0].ID)
+		<-done
+
+		body := []byte(st.Output())
+		if len(body) >= len(large) {
+			t.Errorf("%s: large frame not compressed, %d bytes", accept, len(body))
+		}
+		var r io.Reader
+		if accept == "gzip" {
+			r, _ = gzip.NewReader(bytes.NewReader(body))
+		} else {
+			r, _ = zlib.NewReader(bytes.NewReader(body))
+		}
+		// A complete stream: the checksum in the trailer is verified.
+		plain, err := io.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: invalid stream: %v", accept, err)
+		}
+		for _, want := range []string{"data: tiny\n", "data: " + large + "\n", "data: tiny again\n"} {
+			if !Contains(string(plain), want) {
+				t.Errorf("%s: missing %.30q in %q", accept, want, plain)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestConflationKeepsNewestValueForSlowClient(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 2,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"ticker"}},
+		Metrics:             reg,
+	})
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+
+	// Block the handler inside Write so everything else stays queued.
+	st.Pause()
+	server.Publish([]byte("first"), "ticker")
+	time.Sleep(20 * time.Millisecond)
+
+	for i := 1; i <= 20; i++ {
+		server.PublishWith([]byte("btc-"+Convert(i).String()), PublishOptions{
+			Event:         "price",
+			Channels:      []string{"ticker"},
+			ConflationKey: "BTC",
+		})
+	}
+	server.PublishWith([]byte("eth-1"), PublishOptions{Event: "price", Channels: []string{"ticker"}, ConflationKey: "ETH"})
+	time.Sleep(20 * time.Millisecond)
+
+	st.Resume()
+	time.Sleep(50 * time.Millisecond)
+
+	out := st.Output()
+	if !Contains(out, "data: first") || !Contains(out, "data: btc-20\n") || !Contains(out, "data: eth-1") {
+		t.Fatalf("missing expected messages: %s", out)
+	}
+	if Contains(out, "data: btc-19\n") || Contains(out, "data: btc-1\n") {
+		t.Errorf("superseded values were delivered: %s", out)
+	}
+	if Index(out, "btc-20") > Index(out, "eth-1") {
+		t.Errorf("newest value should keep ascending ID order: %s", out)
+	}
+	if got := reg.Value(MetricMessagesDropped); got != 0 {
+		t.Errorf("expected no drops, got %v", got)
+	}
+	if got := reg.Value(MetricMessagesConflated); got != 19 {
+		t.Errorf("expected 19 conflated updates, got %v", got)
+	}
+}
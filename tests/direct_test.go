@@ -0,0 +1,135 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestPublishToConnection(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:1"}}},
+	})
+	tab1 := connectAs(server, "alice")
+	tab2 := connectAs(server, "alice")
+
+	err := server.PublishWith([]byte("yours"), PublishOptions{Event: "result", Connection: connectionID(t, tab1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !Contains(tab1.Output(), "event: result\ndata: yours\n") {
+		t.Errorf("target connection did not receive the message: %q", tab1.Output())
+	}
+	if Contains(tab2.Output(), "yours") {
+		t.Error("direct message leaked to another connection")
+	}
+
+	if err := server.PublishWith([]byte("x"), PublishOptions{Connection: "nope"}); err != ErrNoRecipient {
+		t.Errorf("expected ErrNoRecipient, got %v", err)
+	}
+
+	// Direct messages are not replayed to other connections.
+	late := newMockStreamer()
+	late.SetHeader("Last-Event-ID", "0")
+	go server.StreamHandler()(late)
+	time.Sleep(30 * time.Millisecond)
+	if Contains(late.Output(), "yours") {
+		t.Errorf("direct message replayed: %q", late.Output())
+	}
+}
+
+func TestAnycastRoundRobin(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"jobs"}},
+	})
+	var workers []*mockStreamer
+	for i := 0; i < 3; i++ {
+		st := newMockStreamer()
+		go server.StreamHandler()(st)
+		time.Sleep(10 * time.Millisecond)
+		workers = append(workers, st)
+	}
+
+	for i := 0; i < 6; i++ {
+		if err := server.PublishWith([]byte("job"), PublishOptions{Channels: []string{"jobs"}, Anycast: AnycastRoundRobin}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	for i, st := range workers {
+		if n := Count(st.Output(), "data: job"); n != 2 {
+			t.Errorf("worker %d: expected 2 jobs, got %d", i, n)
+		}
+	}
+
+	if err := server.PublishWith([]byte("x"), PublishOptions{Channels: []string{"idle"}, Anycast: AnycastRoundRobin}); err != ErrNoRecipient {
+		t.Errorf("expected ErrNoRecipient without subscribers, got %v", err)
+	}
+}
+
+func TestAnycastLeastLoaded(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 20,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"jobs"}},
+	})
+	busy := newMockStreamer()
+	go server.StreamHandler()(busy)
+	time.Sleep(10 * time.Millisecond)
+	idle := newMockStreamer()
+	go server.StreamHandler()(idle)
+	time.Sleep(10 * time.Millisecond)
+
+	busy.Pause() // its queue fills up while idle keeps draining
+	for i := 0; i < 10; i++ {
+		server.PublishWith([]byte("job"), PublishOptions{Channels: []string{"jobs"}, Anycast: AnycastLeastLoaded})
+		time.Sleep(2 * time.Millisecond)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := Count(idle.Output(), "data: job"); n < 8 {
+		t.Errorf("expected the idle worker to take most jobs, got %d of 10", n)
+	}
+	busy.Resume()
+}
+
+func TestAnycastSkipsFullQueues(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 2,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"jobs"}},
+	})
+	slow := newMockStreamer()
+	go server.StreamHandler()(slow)
+	time.Sleep(10 * time.Millisecond)
+	fast := newMockStreamer()
+	go server.StreamHandler()(fast)
+	time.Sleep(10 * time.Millisecond)
+	slowID := connectionID(t, slow)
+
+	slow.Pause()
+	for i := 0; i < 8; i++ {
+		if err := server.PublishWith([]byte("job"), PublishOptions{Channels: []string{"jobs"}, Anycast: AnycastRoundRobin}); err != nil {
+			t.Fatalf("job %d: a full subscriber must be skipped, got %v", i, err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		err = server.PublishWith([]byte("direct"), PublishOptions{Connection: slowID})
+	}
+	if err != ErrQueueFull {
+		t.Errorf("expected ErrQueueFull for a full connection, got %v", err)
+	}
+	slow.Resume()
+	time.Sleep(30 * time.Millisecond)
+	if n := Count(slow.Output(), "data: job") + Count(fast.Output(), "data: job"); n != 8 {
+		t.Errorf("expected all 8 jobs delivered, got %d", n)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestPublishSkipsOrigin(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:1"}}},
+	})
+	tab1 := connectAs(server, "alice")
+	tab2 := connectAs(server, "alice")
+	bob := connectAs(server, "bob")
+
+	// The handler of alice's action learns her connection from the request.
+	req := newRequest("/rename", "")
+	req.SetHeader("X-User", "alice")
+	req.SetHeader(HeaderConnection, connectionID(t, tab1))
+	caller, ok := server.Caller(req)
+	if !ok || caller.Key != "alice" {
+		t.Fatalf("expected alice's connection, got %+v %v", caller, ok)
+	}
+
+	server.PublishWith([]byte("renamed"), PublishOptions{Channels: []string{"room:1"}, Origin: caller.ID})
+	server.PublishWith([]byte("left"), PublishOptions{Channels: []string{"room:1"}, OriginKey: caller.Key})
+	time.Sleep(30 * time.Millisecond)
+
+	cases := []struct {
+		name     string
+		st       *mockStreamer
+		renamed  bool
+		userLeft bool
+	}{
+		{"origin tab", tab1, false, false},
+		{"other tab of the origin", tab2, true, false},
+		{"other user", bob, true, true},
+	}
+	for _, c := range cases {
+		out := c.st.Output()
+		if Contains(out, "data: renamed") != c.renamed || Contains(out, "data: left") != c.userLeft {
+			t.Errorf("%s: unexpected output %q", c.name, out)
+		}
+	}
+}
+
+func TestCallerRejectsForeignConnection(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:1"}}},
+	})
+	alice := connectAs(server, "alice")
+
+	req := newRequest("/rename", "")
+	req.SetHeader("X-User", "mallory")
+	req.SetHeader(HeaderConnection, connectionID(t, alice))
+	if _, ok := server.Caller(req); ok {
+		t.Error("a connection of another identity must not be returned")
+	}
+	if _, ok := server.Caller(newRequest("/rename", "")); ok {
+		t.Error("a request without connection header has no caller")
+	}
+}
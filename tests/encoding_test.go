@@ -0,0 +1,64 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+)
+
+func TestPayloadEncodingRoundTrip(t *testing.T) {
+	payloads := [][]byte{
+		[]byte("plain text\nwith lines"),
+		[]byte("lone\rcarriage return"),
+		{0x00, 0xff, 0xfe, '\n', '\r'},
+		[]byte(MarkerBase64 + "looks encoded"),
+		[]byte(MarkerRaw + "looks escaped"),
+		{},
+	}
+	for _, enc := range []PayloadEncoding{EncodingRaw, EncodingAuto, EncodingBase64, EncodingBase64URL} {
+		for _, p := range payloads {
+			wire := EncodePayload(p, enc)
+			if enc == EncodingRaw {
+				if got := DecodePayload(wire); string(got) != string(p) {
+					t.Errorf("raw: round trip of %q gave %q", p, got)
+				}
+				continue
+			}
+			for _, c := range wire {
+				if c == '\r' || enc != EncodingAuto && c == '\n' {
+					t.Errorf("encoding %d left a line break in %q", enc, wire)
+				}
+			}
+			if got := DecodePayload(wire); string(got) != string(p) {
+				t.Errorf("encoding %d: round trip of %q gave %q", enc, p, got)
+			}
+		}
+	}
+}
+
+func TestPayloadEncodingAutoKeepsText(t *testing.T) {
+	text := []byte("héllo wörld")
+	if got := EncodePayload(text, EncodingAuto); string(got) != string(text) {
+		t.Errorf("auto encoding should leave text untouched, got %q", got)
+	}
+	if got := DecodePayload([]byte("b64:not a marker")); string(got) != "b64:not a marker" {
+		t.Errorf("unmarked data should be returned unchanged, got %q", got)
+	}
+}
+
+func TestDecodePayloadRejectsMalformed(t *testing.T) {
+	cases := map[string]string{
+		MarkerBase64 + "aGk=":    "hi",
+		MarkerBase64URL + "_-8":  "\xff\xef",
+		MarkerBase64 + "aGk":     MarkerBase64 + "aGk", // unpadded
+		MarkerBase64 + "a-k=":    MarkerBase64 + "a-k=",
+		MarkerBase64URL + "aGk=": MarkerBase64URL + "aGk=",
+		MarkerRaw + MarkerBase64: MarkerBase64,
+	}
+	for wire, want := range cases {
+		if got := DecodePayload([]byte(wire)); string(got) != want {
+			t.Errorf("%q: expected %q, got %q", wire, want, got)
+		}
+	}
+}
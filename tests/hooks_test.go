@@ -0,0 +1,82 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestLifecycleHooksOrdering(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(s string) {
+		mu.Lock()
+		calls = append(calls, s)
+		mu.Unlock()
+	}
+
+	var connID string
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+		OnConnect: func(c ConnectionInfo) {
+			connID = c.ID
+			record("connect")
+		},
+		OnPublish: func(msg *SSEMessage, channels []string) {
+			if msg.Id == "" || channels[0] != "all" {
+				t.Errorf("publish hook got id %q channels %v", msg.Id, channels)
+			}
+			record("publish:" + string(msg.Data))
+		},
+		OnDeliver: func(c ConnectionInfo, msg *SSEMessage) {
+			if c.ID != connID {
+				t.Errorf("deliver for unexpected connection %q", c.ID)
+			}
+			record("deliver:" + string(msg.Data))
+		},
+		OnDisconnect: func(c ConnectionInfo, reason string) {
+			record("disconnect:" + reason)
+		},
+	})
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+
+	server.Publish([]byte("a"), "all")
+	server.Publish([]byte("b"), "all")
+	time.Sleep(50 * time.Millisecond)
+
+	st.Close()
+	server.Publish([]byte("c"), "all")
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Publish and deliver run on different goroutines, so only the order
+	// within each hook and the connect/disconnect bracket are guaranteed.
+	if len(calls) != 7 || calls[0] != "connect" || calls[6] != "disconnect:"+DisconnectClientGone {
+		t.Fatalf("unexpected hook calls: %v", calls)
+	}
+	var publishes, deliveries []string
+	for _, c := range calls[1:6] {
+		switch c[0] {
+		case 'p':
+			publishes = append(publishes, c)
+		case 'd':
+			deliveries = append(deliveries, c)
+		}
+	}
+	if JoinSlice(publishes, ",") != "publish:a,publish:b,publish:c" {
+		t.Errorf("unexpected publish order: %v", publishes)
+	}
+	if JoinSlice(deliveries, ",") != "deliver:a,deliver:b" {
+		t.Errorf("unexpected delivery order: %v", deliveries)
+	}
+}
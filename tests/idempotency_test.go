@@ -0,0 +1,161 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func newIdempotentServer(t *testing.T, window time.Duration) (*SSEServer, *MetricsRegistry) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		IdempotencyWindow:   window,
+		Metrics:             reg,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+	})
+	return server, reg
+}
+
+func TestIdempotencyKeySuppressesDuplicates(t *testing.T) {
+	server, reg := newIdempotentServer(t, time.Minute)
+	st := connectAs(server, "alice")
+
+	opts := PublishOptions{Event: "order", Channels: []string{"all"}, IdempotencyKey: "order-1"}
+	first, err := server.PublishWithID([]byte("o1"), opts)
+	if err != nil || first == "" {
+		t.Fatalf("first publish: id %q, err %v", first, err)
+	}
+	again, err := server.PublishWithID([]byte("o1 retry"), opts)
+	if err != nil || again != first {
+		t.Fatalf("duplicate must return the original ID %q, got %q (err %v)", first, again, err)
+	}
+	if err := server.PublishWith([]byte("o1 retry"), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.IdempotencyKey = "order-2"
+	other, err := server.PublishWithID([]byte("o2"), opts)
+	if err != nil || other == "" || other == first {
+		t.Fatalf("another key must publish with a new ID, got %q (first %q, err %v)", other, first, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	out := st.Output()
+	if Count(out, "data: o1") != 1 || Contains(out, "retry") || !Contains(out, "data: o2") {
+		t.Errorf("expected o1 once and o2, got:\n%s", out)
+	}
+	if got := reg.Value(MetricMessagesDuplicate); got != 2 {
+		t.Errorf("expected 2 duplicates counted, got %v", got)
+	}
+}
+
+func TestIdempotencyKeyExpiresAfterWindow(t *testing.T) {
+	server, _ := newIdempotentServer(t, 30*time.Millisecond)
+	st := connectAs(server, "alice")
+
+	opts := PublishOptions{Channels: []string{"all"}, IdempotencyKey: "k"}
+	first, _ := server.PublishWithID([]byte("m1"), opts)
+	time.Sleep(50 * time.Millisecond)
+	second, _ := server.PublishWithID([]byte("m2"), opts)
+	if second == "" || second == first {
+		t.Fatalf("key must be forgotten after the window, got %q then %q", first, second)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if out := st.Output(); !Contains(out, "data: m1") || !Contains(out, "data: m2") {
+		t.Errorf("expected both messages, got:\n%s", out)
+	}
+}
+
+func TestIdempotencyKeyConcurrentDuplicates(t *testing.T) {
+	server, _ := newIdempotentServer(t, time.Minute)
+	st := connectAs(server, "alice")
+
+	opts := PublishOptions{Channels: []string{"all"}, IdempotencyKey: "race"}
+	ids := make([]string, 10)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], _ = server.PublishWithID([]byte("once"), opts)
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range ids {
+		if id == "" || id != ids[0] {
+			t.Fatalf("all publishes must share one ID, got %v", ids)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := Count(st.Output(), "data: once"); n != 1 {
+		t.Errorf("expected a single delivery, got %d", n)
+	}
+}
+
+func TestPublishHandlerIdempotencyKey(t *testing.T) {
+	server, _ := newIdempotentServer(t, time.Minute)
+	st := connectAs(server, "alice")
+	handler := server.PublishHandler(tokenAuthorizer{})
+
+	req := newPublishRequest("paid", HeaderPublishChannels, "all", HeaderIdempotencyKey, "pay-9")
+	handler(req)
+	id := req.GetHeader(HeaderEventID)
+	if req.Status != 204 || id == "" {
+		t.Fatalf("expected 204 with %s, got %d %q", HeaderEventID, req.Status, id)
+	}
+
+	req = newPublishRequest("paid", HeaderPublishChannels, "all", HeaderIdempotencyKey, "pay-9")
+	handler(req)
+	if req.Status != 204 || req.GetHeader(HeaderEventID) != id {
+		t.Errorf("retry must answer the original ID %q, got %d %q", id, req.Status, req.GetHeader(HeaderEventID))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := Count(st.Output(), "data: paid"); n != 1 {
+		t.Errorf("expected a single delivery, got %d", n)
+	}
+}
+
+func TestIdempotencyKeyRemembersOutcome(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		Metrics:             reg,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all", "limited", "slow"}},
+		PublishRateLimits: []PublishRateLimit{
+			{Channels: []string{"limited"}, Rate: 1, Burst: 1},
+			{Channels: []string{"slow"}, Rate: 20, Policy: RateThrottle},
+		},
+	})
+	st := connectAs(server, "alice")
+	server.Publish([]byte("warm"), "limited")
+	server.Publish([]byte("warm"), "slow")
+
+	// Partly rejected: the retry gets the same ID and the same error.
+	opts := PublishOptions{Channels: []string{"all", "limited"}, IdempotencyKey: "partial"}
+	first, firstErr := server.PublishWithID([]byte("partial"), opts)
+	again, againErr := server.PublishWithID([]byte("partial"), opts)
+	if first == "" || firstErr == nil || again != first || againErr == nil || againErr.Error() != firstErr.Error() {
+		t.Errorf("expected %q with %v again, got %q with %v", first, firstErr, again, againErr)
+	}
+
+	// Held back by RateThrottle: the retry must not send a second copy.
+	opts = PublishOptions{Channels: []string{"slow"}, IdempotencyKey: "held"}
+	for i := 0; i < 2; i++ {
+		if id, err := server.PublishWithID([]byte("held"), opts); id != "" || err != nil {
+			t.Fatalf("publish %d: expected a held message, got %q (err %v)", i, id, err)
+		}
+	}
+	time.Sleep(120 * time.Millisecond)
+	if n := Count(st.Output(), "data: held"); n != 1 {
+		t.Errorf("expected the held message delivered once, got %d", n)
+	}
+	if got := reg.Value(MetricMessagesDuplicate); got != 2 {
+		t.Errorf("expected both retries suppressed as duplicates, got %v", got)
+	}
+}
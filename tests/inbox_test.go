@@ -0,0 +1,221 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestInboxDeliversOnNextConnection(t *testing.T) {
+	reg := NewMetricsRegistry()
+	store := NewMemoryInbox()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"user:bob", "all"}},
+		Metrics:             reg,
+		InboxChannels:       []string{"user:*"},
+		InboxMaxMessages:    2,
+		InboxStore:          store,
+	})
+
+	server.Publish([]byte("m1"), "user:bob")
+	server.Publish([]byte("m2"), "user:bob")
+	server.PublishEvent("", []byte("m3"), "user:bob", "all")
+	server.Publish([]byte("broadcast"), "all") // not an inbox channel
+	time.Sleep(30 * time.Millisecond)
+	if store.Len("user:bob") != 2 || reg.Value(MetricInboxDropped) != 1 {
+		t.Fatalf("expected 2 stored and 1 dropped, got %d and %v", store.Len("user:bob"), reg.Value(MetricInboxDropped))
+	}
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	out := st.Output()
+	if !Contains(out, "data: m2\n") || Index(out, "data: m2") > Index(out, "data: m3") {
+		t.Errorf("expected m2 and m3 in order, got %q", out)
+	}
+	if Contains(out, "data: m1") || Contains(out, "broadcast") {
+		t.Errorf("dropped and non-inbox messages must not be delivered, got %q", out)
+	}
+
+	// Online recipients get messages directly; nothing is stored.
+	server.Publish([]byte("live"), "user:bob")
+	time.Sleep(30 * time.Millisecond)
+	if store.Len("user:bob") != 0 {
+		t.Error("messages for a connected channel must not be stored")
+	}
+
+	again := newMockStreamer()
+	go server.StreamHandler()(again)
+	time.Sleep(30 * time.Millisecond)
+	if Contains(again.Output(), "data: m") {
+		t.Errorf("inbox delivered twice: %q", again.Output())
+	}
+	if got := reg.Value(MetricInboxDelivered); got != 2 {
+		t.Errorf("expected 2 delivered, got %v", got)
+	}
+}
+
+func TestInboxExpiresMessages(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"user:bob"}},
+		InboxChannels:       []string{"user:bob"},
+		InboxTTL:            20 * time.Millisecond,
+	})
+	server.Publish([]byte("stale"), "user:bob")
+	time.Sleep(50 * time.Millisecond)
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	if Contains(st.Output(), "stale") {
+		t.Errorf("expired message delivered: %q", st.Output())
+	}
+
+	store := NewMemoryInbox()
+	now := time.Now()
+	store.Append("user:1", &SSEMessage{Id: "1"}, now.Add(-time.Second), 0)
+	store.Append("user:1", &SSEMessage{Id: "2"}, now.Add(time.Hour), 0)
+	store.Expire(now)
+	if store.Len("user:1") != 1 {
+		t.Errorf("expected 1 message left after Expire, got %d", store.Len("user:1"))
+	}
+}
+
+func TestCatchUpQueuesInIDOrder(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 1,
+		ReplayAllOnConnect:  true,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"user:bob"}},
+		InboxChannels:       []string{"user:*"},
+	})
+
+	// History keeps only m3; the inbox has all three.
+	server.Publish([]byte("m1"), "user:bob")
+	server.Publish([]byte("m2"), "user:bob")
+	server.Publish([]byte("m3"), "user:bob")
+	time.Sleep(20 * time.Millisecond)
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	out := st.Output()
+	m1, m2, m3 := Index(out, "data: m1"), Index(out, "data: m2"), Index(out, "data: m3")
+	if m1 < 0 || m1 > m2 || m2 > m3 || Count(out, "data: m3") != 1 {
+		t.Errorf("expected m1, m2, m3 once each in ID order, got %q", out)
+	}
+}
+
+func TestInboxKeepsMessagesUntilWritten(t *testing.T) {
+	store := NewMemoryInbox()
+	newServer := func() *SSEServer {
+		return New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+			ClientChannelBuffer: 10,
+			ChannelProvider:     &mockChannelProvider{channels: []string{"user:bob"}},
+			InboxChannels:       []string{"user:*"},
+			InboxStore:          store,
+		})
+	}
+	server := newServer()
+	server.Publish([]byte("m1"), "user:bob")
+	time.Sleep(20 * time.Millisecond)
+
+	gone := newMockStreamer()
+	gone.Close() // every write fails
+	go server.StreamHandler()(gone)
+	time.Sleep(30 * time.Millisecond)
+	if store.Len("user:bob") != 1 {
+		t.Fatalf("a message not written must stay stored, got %d", store.Len("user:bob"))
+	}
+
+	// A restarted server shares the store; its IDs must sort after the old ones.
+	server = newServer()
+	server.Publish([]byte("m2"), "user:bob")
+	time.Sleep(20 * time.Millisecond)
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	out := st.Output()
+	if m1, m2 := Index(out, "data: m1"), Index(out, "data: m2"); m1 < 0 || m1 > m2 {
+		t.Errorf("expected m1 then m2, got %q", out)
+	}
+	if store.Len("user:bob") != 0 {
+		t.Errorf("written messages must be removed, %d left", store.Len("user:bob"))
+	}
+}
+
+func TestInboxKeepsReplayedMessagesUntilWritten(t *testing.T) {
+	store := NewMemoryInbox()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"user:bob"}},
+		HistoryReplayBuffer: 10,
+		ReplayAllOnConnect:  true,
+		InboxChannels:       []string{"user:*"},
+		InboxStore:          store,
+	})
+	server.Publish([]byte("m1"), "user:bob")
+	time.Sleep(20 * time.Millisecond)
+
+	gone := newMockStreamer()
+	gone.Close() // the replayed copy is never written
+	go server.StreamHandler()(gone)
+	time.Sleep(30 * time.Millisecond)
+	if store.Len("user:bob") != 1 {
+		t.Fatalf("a message also replayed must stay stored until written, got %d", store.Len("user:bob"))
+	}
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	if n := Count(st.Output(), "data: m1"); n != 1 {
+		t.Errorf("expected m1 once, got %q", st.Output())
+	}
+	if store.Len("user:bob") != 0 {
+		t.Errorf("written messages must be removed, %d left", store.Len("user:bob"))
+	}
+}
+
+// slowInbox blocks Append until release is closed.
+type slowInbox struct {
+	*MemoryInbox
+	release chan struct{}
+}
+
+func (s *slowInbox) Append(channel string, msg *SSEMessage, expiresAt time.Time, limit int) (int, error) {
+	<-s.release
+	return s.MemoryInbox.Append(channel, msg, expiresAt, limit)
+}
+
+func TestInboxStoreDoesNotBlockPublishing(t *testing.T) {
+	store := &slowInbox{MemoryInbox: NewMemoryInbox(), release: make(chan struct{})}
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     headerChannels{},
+		InboxChannels:       []string{"user:*"},
+		InboxStore:          store,
+	})
+	st := newMockStreamer()
+	st.SetHeader("X-Channels", "all")
+	go server.StreamHandler()(st)
+	time.Sleep(20 * time.Millisecond)
+
+	server.Publish([]byte("stored"), "user:bob")
+	server.Publish([]byte("live"), "all")
+	time.Sleep(20 * time.Millisecond)
+	if !Contains(st.Output(), "data: live") {
+		t.Errorf("a slow InboxStore must not hold up delivery, got %q", st.Output())
+	}
+	close(store.release)
+	time.Sleep(20 * time.Millisecond)
+	if store.Len("user:bob") != 1 {
+		t.Errorf("expected the message stored once the store caught up, got %d", store.Len("user:bob"))
+	}
+}
@@ -0,0 +1,155 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestConnectionLimitRejects(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"all"}}},
+		MaxConnections:      2,
+		LimitRetryAfter:     9,
+	})
+
+	connectAs(server, "alice")
+	bob := connectAs(server, "bob")
+
+	st := newMockStreamer()
+	server.StreamHandler()(st) // rejected: returns immediately
+	if st.Status != 429 {
+		t.Fatalf("expected 429, got %d", st.Status)
+	}
+	if got := st.GetHeader("Retry-After"); got != "9" {
+		t.Errorf("expected Retry-After 9, got %q", got)
+	}
+	if got := st.GetHeader(ErrorHeader); got != "rate_limited" {
+		t.Errorf("expected %s rate_limited, got %q", ErrorHeader, got)
+	}
+
+	// A slot frees up once a connection leaves.
+	disconnect(server, bob, "all")
+	if connectAs(server, "carol").FlushCount() == 0 {
+		t.Error("expected connection to be accepted after a disconnect")
+	}
+}
+
+func TestConnectionLimitPerChannel(t *testing.T) {
+	provider := &identityProvider{mockChannelProvider{channels: []string{"room:1"}}}
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer:      10,
+		ChannelProvider:          provider,
+		MaxConnectionsPerChannel: 1,
+	})
+
+	connectAs(server, "alice")
+	st := newMockStreamer()
+	server.StreamHandler()(st)
+	if st.Status != 429 {
+		t.Fatalf("expected 429 for a full channel, got %d", st.Status)
+	}
+
+	provider.channels = []string{"room:2"}
+	if connectAs(server, "bob").FlushCount() == 0 {
+		t.Error("other channels must not be affected")
+	}
+}
+
+func TestConnectionLimitPerKeyEvictsOldest(t *testing.T) {
+	var mu sync.Mutex
+	reasons := map[string]string{}
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer:  10,
+		ChannelProvider:      &identityProvider{mockChannelProvider{channels: []string{"all"}}},
+		MaxConnectionsPerKey: 1,
+		LimitPolicy:          LimitEvictOldest,
+		OnDisconnect: func(conn ConnectionInfo, reason string) {
+			mu.Lock()
+			reasons[conn.Key] = reason
+			mu.Unlock()
+		},
+	})
+
+	first := connectAs(server, "alice")
+	second := connectAs(server, "alice")
+	connectAs(server, "bob")
+
+	if second.FlushCount() == 0 {
+		t.Fatal("expected the new connection to be accepted")
+	}
+	if !Contains(first.Output(), "event: "+EvictedEvent) {
+		t.Errorf("expected evicted event on the old stream, got %q", first.Output())
+	}
+
+	mu.Lock()
+	if reasons["alice"] != DisconnectEvicted {
+		t.Errorf("expected reason %q, got %q", DisconnectEvicted, reasons["alice"])
+	}
+	if _, ok := reasons["bob"]; ok {
+		t.Error("other keys must not be evicted")
+	}
+	mu.Unlock()
+
+	server.Publish([]byte("hello"), "all")
+	time.Sleep(30 * time.Millisecond)
+	if Contains(first.Output(), "hello") || !Contains(second.Output(), "hello") {
+		t.Error("only the newest connection should receive messages")
+	}
+}
+
+func TestConnectionLimitPerKeyRejects(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer:  10,
+		ChannelProvider:      &identityProvider{mockChannelProvider{channels: []string{"all"}}},
+		MaxConnectionsPerKey: 1,
+	})
+
+	first := connectAs(server, "alice")
+	st := newMockStreamer()
+	st.SetHeader("X-User", "alice")
+	server.StreamHandler()(st)
+	if st.Status != 429 {
+		t.Fatalf("expected 429, got %d", st.Status)
+	}
+	if Contains(first.Output(), EvictedEvent) {
+		t.Error("LimitReject must not evict")
+	}
+}
+
+func TestProbeReportsRejectionWithoutConnecting(t *testing.T) {
+	connects := 0
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"all"}}},
+		MaxConnections:      1,
+		OnConnect:           func(ConnectionInfo) { connects++ },
+	})
+
+	probe := newMockStreamer()
+	probe.SetHeader(HeaderProbe, "1")
+	server.StreamHandler()(probe)
+	if probe.Status != 200 || probe.Output() != "" {
+		t.Fatalf("expected an empty 200, got %d %q", probe.Status, probe.Output())
+	}
+	if n := len(server.Connections()); n != 0 || connects != 0 {
+		t.Fatalf("a probe must not connect, got %d connections, %d OnConnect", n, connects)
+	}
+
+	connectAs(server, "alice")
+	probe = newMockStreamer()
+	probe.SetHeader(HeaderProbe, "1")
+	server.StreamHandler()(probe)
+	if probe.Status != 429 || probe.GetHeader(ErrorHeader) != "rate_limited" {
+		t.Errorf("expected the limit rejection, got %d %q", probe.Status, probe.GetHeader(ErrorHeader))
+	}
+	if n := len(server.Connections()); n != 1 {
+		t.Errorf("expected alice only, got %d connections", n)
+	}
+}
@@ -0,0 +1,129 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+type logEntry struct {
+	level  LogLevel
+	msg    string
+	fields []any
+}
+
+// recordingLogger implements Logger and keeps every entry.
+type recordingLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) Log(level LogLevel, msg string, fields ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, logEntry{level, msg, fields})
+}
+
+func (l *recordingLogger) find(msg string) (logEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e.msg == msg {
+			return e, true
+		}
+	}
+	return logEntry{}, false
+}
+
+func field(e logEntry, key string) any {
+	for i := 0; i+1 < len(e.fields); i += 2 {
+		if e.fields[i] == key {
+			return e.fields[i+1]
+		}
+	}
+	return nil
+}
+
+func TestLoggerLifecycleEvents(t *testing.T) {
+	logger := &recordingLogger{}
+	server := New(&Config{Logger: logger}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ReplayAllOnConnect:  true,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+	})
+
+	server.Publish([]byte("old"), "all")
+	time.Sleep(20 * time.Millisecond)
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+	disconnect(server, st, "all")
+
+	connect, ok := logger.find(LogConnect)
+	if !ok {
+		t.Fatal("missing connect entry")
+	}
+	if connect.level != LevelInfo || field(connect, "conn") == "" {
+		t.Errorf("unexpected connect entry: %+v", connect)
+	}
+
+	replay, ok := logger.find(LogReplay)
+	if !ok || field(replay, "count") != 1 {
+		t.Errorf("expected replay entry with count 1, got %+v", replay)
+	}
+
+	gone, ok := logger.find(LogDisconnect)
+	if !ok {
+		t.Fatal("missing disconnect entry")
+	}
+	if field(gone, "conn") != field(connect, "conn") {
+		t.Error("disconnect should carry the same connection ID as connect")
+	}
+	if field(gone, "reason") != DisconnectClientGone || field(gone, "error") == nil {
+		t.Errorf("unexpected disconnect entry: %+v", gone)
+	}
+}
+
+func TestLoggerRejectedAndLevelFilter(t *testing.T) {
+	logger := &recordingLogger{}
+	server := New(&Config{Logger: logger, LogLevel: LevelWarn}).Server(&ServerConfig{
+		ChannelProvider: &mockChannelProvider{err: Err("auth failed")},
+	})
+
+	server.StreamHandler()(newMockStreamer())
+
+	rejected, ok := logger.find(LogRejected)
+	if !ok || rejected.level != LevelWarn || field(rejected, "status") != 401 {
+		t.Errorf("expected warn rejected entry with status 401, got %+v", rejected)
+	}
+	if _, ok := logger.find(LogConnect); ok {
+		t.Error("info entries should be filtered out below LogLevel")
+	}
+}
+
+func TestLogFuncAdapter(t *testing.T) {
+	var got []any
+	server := New(&Config{Log: func(args ...any) { got = args }}).Server(&ServerConfig{
+		ChannelProvider: &mockChannelProvider{err: Err("denied")},
+	})
+
+	server.StreamHandler()(newMockStreamer())
+
+	var parts []string
+	for _, a := range got {
+		parts = append(parts, Convert(a).String())
+	}
+	line := JoinSlice(parts, " ")
+	for _, want := range []string{"[WARN]", LogRejected, "status=401", "error=denied"} {
+		if !Contains(line, want) {
+			t.Errorf("missing %q in %q", want, line)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestMetricsCountsDeliveryAndReplay(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ReplayAllOnConnect:  true,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+		Metrics:             reg,
+	})
+
+	server.Publish([]byte("before"), "all")
+	time.Sleep(20 * time.Millisecond)
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+
+	server.Publish([]byte("after"), "all")
+	time.Sleep(50 * time.Millisecond)
+
+	checks := []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{MetricClientsConnected, nil, 1},
+		{MetricChannelSubscribers, []string{"channel", "all"}, 1},
+		{MetricMessagesPublished, nil, 2},
+		{MetricMessagesReplayed, nil, 1},
+		{MetricMessagesDelivered, nil, 2},
+		{MetricHistorySize, nil, 2},
+	}
+	for _, c := range checks {
+		if got := reg.Value(c.name, c.labels...); got != c.want {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestMetricsRegistryHandlerExposition(t *testing.T) {
+	reg := NewMetricsRegistry()
+	reg.Add(MetricMessagesPublished, 3)
+	reg.Set(MetricChannelSubscribers, 2, "channel", `room"1`)
+	reg.Observe(MetricWriteSeconds, 0.5)
+	reg.Observe(MetricWriteSeconds, 0.25)
+
+	st := newMockStreamer()
+	reg.Handler()(st)
+
+	out := st.Output()
+	for _, want := range []string{
+		"# TYPE sse_messages_published_total counter\nsse_messages_published_total 3\n",
+		`sse_channel_subscribers{channel="room\"1"} 2`,
+		"# TYPE sse_write_duration_seconds summary\n",
+		"sse_write_duration_seconds_sum 0.75\n",
+		"sse_write_duration_seconds_count 2\n",
+	} {
+		if !Contains(out, want) {
+			t.Errorf("missing %q in exposition:\n%s", want, out)
+		}
+	}
+	if st.Status != 200 {
+		t.Errorf("expected status 200, got %d", st.Status)
+	}
+}
+
+func TestMetricsDropsEmptyChannelSeries(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all", "user:7"}},
+		Metrics:             reg,
+	})
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+	if !Contains(string(reg.WriteText()), `sse_channel_subscribers{channel="user:7"} 1`) {
+		t.Fatalf("expected a series for user:7, got:\n%s", reg.WriteText())
+	}
+
+	disconnect(server, st, "all")
+	if out := string(reg.WriteText()); Contains(out, `channel="user:7"`) {
+		t.Errorf("series of an empty channel must be deleted, got:\n%s", out)
+	}
+}
@@ -0,0 +1,127 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// identityProvider resolves the member key from the "X-User" request header.
+type identityProvider struct {
+	mockChannelProvider
+}
+
+func (p *identityProvider) ResolveIdentity(ctx router.Context) (string, []byte) {
+	user := ctx.GetHeader("X-User")
+	return user, []byte("meta-" + user)
+}
+
+// connectAs opens a stream for user and waits for it to register.
+func connectAs(server *SSEServer, user string) *mockStreamer {
+	st := newMockStreamer()
+	st.SetHeader("X-User", user)
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	return st
+}
+
+// disconnect closes st and publishes a ping so the handler notices the failed write.
+func disconnect(server *SSEServer, st *mockStreamer, channel string) {
+	st.Close()
+	server.PublishEvent("ping", nil, channel)
+	time.Sleep(30 * time.Millisecond)
+}
+
+func TestPresenceTracksMembers(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:42"}}},
+		PresenceChannels:    []string{"room:*"},
+	})
+
+	alice1 := connectAs(server, "alice")
+	connectAs(server, "alice")
+	connectAs(server, "bob")
+
+	members := server.Presence("room:42")
+	if len(members) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(members))
+	}
+	if members[0].Key != "alice" || members[0].Connections != 2 {
+		t.Errorf("expected alice with 2 connections, got %+v", members[0])
+	}
+	if string(members[0].Meta) != "meta-alice" {
+		t.Errorf("expected provider metadata, got %q", members[0].Meta)
+	}
+	if server.Presence("other") != nil {
+		t.Error("untracked channel should have no presence")
+	}
+
+	disconnect(server, alice1, "room:42")
+	if members = server.Presence("room:42"); members[0].Connections != 1 {
+		t.Errorf("expected alice with 1 connection after disconnect, got %d", members[0].Connections)
+	}
+}
+
+func TestPresenceEventsDebounceReconnect(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:1"}}},
+		PresenceChannels:    []string{"room:1"},
+		PresenceEvents:      true,
+		PresenceDebounce:    150 * time.Millisecond,
+	})
+
+	observer := connectAs(server, "observer")
+	bob := connectAs(server, "bob")
+
+	if n := Count(observer.Output(), "event: presence.join"); n != 2 {
+		t.Fatalf("expected 2 join events (observer, bob), got %d: %s", n, observer.Output())
+	}
+
+	// Flapping reconnect within the debounce window: neither leave nor join.
+	disconnect(server, bob, "room:1")
+	bob = connectAs(server, "bob")
+	time.Sleep(200 * time.Millisecond)
+
+	out := observer.Output()
+	if Contains(out, "event: presence.leave") {
+		t.Errorf("unexpected leave during flapping reconnect: %s", out)
+	}
+	if n := Count(out, "event: presence.join"); n != 2 {
+		t.Errorf("unexpected join during flapping reconnect, got %d joins", n)
+	}
+
+	// A real leave is emitted once the window elapses.
+	disconnect(server, bob, "room:1")
+	time.Sleep(200 * time.Millisecond)
+
+	out = observer.Output()
+	if !Contains(out, "event: presence.leave") || !Contains(out, `"key":"bob"`) {
+		t.Errorf("expected leave event for bob, got: %s", out)
+	}
+}
+
+func TestPresenceJoinFollowsReplay(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:1"}}},
+		HistoryReplayBuffer: 10,
+		ReplayAllOnConnect:  true,
+		PresenceChannels:    []string{"room:1"},
+		PresenceEvents:      true,
+	})
+	server.Publish([]byte("m1"), "room:1")
+	time.Sleep(20 * time.Millisecond)
+
+	out := connectAs(server, "bob").Output()
+	if m1, join := Index(out, "data: m1"), Index(out, "event: "+PresenceJoinEvent); m1 < 0 || join < m1 {
+		t.Errorf("expected the replay before the join event, got %q", out)
+	}
+	assertAscendingIDs(t, out)
+}
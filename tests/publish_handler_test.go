@@ -0,0 +1,123 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// tokenAuthorizer allows "Bearer secret" to publish outside "admin:*".
+type tokenAuthorizer struct{}
+
+func (tokenAuthorizer) AuthorizePublish(ctx router.Context, event string, channels []string) error {
+	if ctx.GetHeader("Authorization") != "Bearer secret" {
+		return Unauthorized("invalid token")
+	}
+	for _, ch := range channels {
+		if HasPrefix(ch, "admin:") {
+			return Forbidden("cannot publish to " + ch)
+		}
+	}
+	return nil
+}
+
+func newPublishRequest(body string, headers ...string) *request {
+	req := newRequest("/sse/publish", body)
+	req.SetHeader("Authorization", "Bearer secret")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.SetHeader(headers[i], headers[i+1])
+	}
+	return req
+}
+
+func TestPublishHandlerAcceptsJSONAndRawBodies(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all", "jobs"}},
+	})
+	st := connectAs(server, "alice")
+	handler := server.PublishHandler(tokenAuthorizer{})
+
+	req := newPublishRequest(`{"event":"job.done","channels":"jobs","data":"{\"id\":7}"}`, "Content-Type", "application/json")
+	handler(req)
+	if req.Status != 204 {
+		t.Fatalf("JSON publish: expected 204, got %d %s", req.Status, req.Output())
+	}
+
+	req = newPublishRequest("line 1\nline 2", HeaderPublishEvent, "log", HeaderPublishChannels, "all")
+	handler(req)
+	if req.Status != 204 {
+		t.Fatalf("raw publish: expected 204, got %d %s", req.Status, req.Output())
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	out := st.Output()
+	if !Contains(out, "event: job.done\ndata: {\"id\":7}\n") {
+		t.Errorf("expected the JSON publish, got %q", out)
+	}
+	if !Contains(out, "event: log\ndata: line 1\ndata: line 2\n") {
+		t.Errorf("expected the raw publish, got %q", out)
+	}
+}
+
+func TestPublishHandlerRejects(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ChannelProvider: &mockChannelProvider{channels: []string{"all"}},
+	})
+	handler := server.PublishHandler(tokenAuthorizer{})
+
+	cases := []struct {
+		name   string
+		req    *request
+		status int
+	}{
+		{"bad token", newPublishRequest("x", HeaderPublishChannels, "all", "Authorization", "Bearer nope"), 401},
+		{"forbidden channel", newPublishRequest("x", HeaderPublishChannels, "all,admin:ops"), 403},
+		{"no channels", newPublishRequest("x"), 400},
+		{"invalid JSON", newPublishRequest("{", "Content-Type", "application/json"), 400},
+		{"invalid JSON, bad token", newPublishRequest("{", "Content-Type", "application/json", "Authorization", "Bearer nope"), 401},
+		{"line break in event header", newPublishRequest("x", HeaderPublishChannels, "all", HeaderPublishEvent, "a\nevent: b"), 400},
+		{"line break in JSON event", newPublishRequest(`{"event":"a\r\ndata: b","channels":["all"],"data":"x"}`, "Content-Type", "application/json"), 400},
+	}
+	for _, c := range cases {
+		handler(c.req)
+		if c.req.Status != c.status || !Contains(c.req.Output(), `"error":`) {
+			t.Errorf("%s: expected %d with a JSON error, got %d %s", c.name, c.status, c.req.Status, c.req.Output())
+		}
+	}
+
+	req := newPublishRequest("x", HeaderPublishChannels, "all")
+	server.PublishHandler(nil)(req)
+	if req.Status != 403 {
+		t.Errorf("nil authorizer must reject, got %d", req.Status)
+	}
+}
+
+func TestPublishRejectsLineBreaksInEvent(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+	})
+	st := connectAs(server, "alice")
+
+	for _, event := range []string{"a\nevent: b", "a\rb"} {
+		if err := server.PublishWith([]byte("x"), PublishOptions{Event: event, Channels: []string{"all"}}); err != ErrInvalidEvent {
+			t.Errorf("event %q: expected ErrInvalidEvent, got %v", event, err)
+		}
+	}
+	server.Publish([]byte("one\rid: 9\r\ntwo"), "all")
+	time.Sleep(30 * time.Millisecond)
+
+	out := st.Output()
+	if Contains(out, "data: x") || Contains(out, "\nid: 9") {
+		t.Errorf("line breaks must not inject messages or fields, got:\n%q", out)
+	}
+	if !Contains(out, "data: one\ndata: id: 9\ndata: two\n\n") {
+		t.Errorf("expected every data line prefixed, got:\n%q", out)
+	}
+}
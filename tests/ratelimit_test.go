@@ -0,0 +1,211 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	"errors"
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestPublishRateLimitRejects(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all", "audit"}},
+		Metrics:             reg,
+		PublishRateLimits:   []PublishRateLimit{{Channels: []string{"all"}, Rate: 1, Burst: 2}},
+	})
+	st := connectAs(server, "alice")
+
+	for i := 0; i < 2; i++ {
+		if err := server.PublishWith([]byte("ok"), PublishOptions{Channels: []string{"all"}}); err != nil {
+			t.Fatalf("publish %d within burst: %v", i, err)
+		}
+	}
+	err := server.PublishWith([]byte("flood"), PublishOptions{Channels: []string{"all", "audit"}})
+	var sseErr *SSEError
+	if !errors.As(err, &sseErr) || sseErr.Kind != ErrorRateLimited || sseErr.RetryAfter != 1 {
+		t.Fatalf("expected a RateLimited error with Retry-After 1, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// Unlimited channels of the same publish are still delivered, once.
+	if n := Count(st.Output(), "data: flood"); n != 1 {
+		t.Errorf("expected flood delivered once through audit, got %d", n)
+	}
+	if reg.Value(MetricMessagesRateLimited, "channel", "all", "action", "rejected") != 1 {
+		t.Error("expected the rejection to be counted")
+	}
+}
+
+func TestPublishRateLimitDelays(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+		PublishRateLimits:   []PublishRateLimit{{Channels: []string{"*"}, Rate: 10, Policy: RateDelay}},
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		server.Publish([]byte("x"), "all")
+	}
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("expected publishes to be paced at 10/s, took %v", elapsed)
+	}
+}
+
+func TestPublishRateLimitDelayRejectsBeyondMaxDelay(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+		PublishRateLimits: []PublishRateLimit{
+			{Channels: []string{"all"}, Rate: 1, Policy: RateDelay, MaxDelay: 100 * time.Millisecond},
+		},
+	})
+
+	server.PublishWith(nil, PublishOptions{Channels: []string{"all"}}) //nolint:errcheck
+	if err := server.PublishWith(nil, PublishOptions{Channels: []string{"all"}}); err == nil {
+		t.Error("expected a rejection when the wait exceeds MaxDelay")
+	}
+}
+
+func TestPublishRateLimitThrottleLatestWins(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"ticker"}},
+		Metrics:             reg,
+		PublishRateLimits:   []PublishRateLimit{{Channels: []string{"ticker"}, Rate: 10, Policy: RateThrottle}},
+	})
+	st := connectAs(server, "alice")
+
+	for i := 1; i <= 5; i++ {
+		if err := server.PublishWith([]byte("v"+Convert(i).String()), PublishOptions{Channels: []string{"ticker"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if out := st.Output(); !Contains(out, "data: v1") || Contains(out, "data: v5") {
+		t.Fatalf("expected only the first value before the budget refills, got %q", out)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	out := st.Output()
+	for _, skipped := range []string{"v2", "v3", "v4"} {
+		if Contains(out, "data: "+skipped) {
+			t.Errorf("%s should have been replaced by a newer value", skipped)
+		}
+	}
+	if !Contains(out, "data: v5") {
+		t.Errorf("expected the latest value to be delivered, got %q", out)
+	}
+	if got := reg.Value(MetricMessagesRateLimited, "channel", "ticker", "action", "replaced"); got != 3 {
+		t.Errorf("expected 3 replaced messages, got %v", got)
+	}
+}
+
+func TestPublishRateLimitThrottleDeliversOnce(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     headerChannels{},
+		PublishRateLimits:   []PublishRateLimit{{Channels: []string{"ticker"}, Rate: 20, Policy: RateThrottle}},
+	})
+	streams := map[string]*mockStreamer{}
+	for _, channels := range []string{"ticker", "all", "ticker,all"} {
+		st := newMockStreamer()
+		st.SetHeader("X-Channels", channels)
+		go server.StreamHandler()(st)
+		streams[channels] = st
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	server.PublishWith([]byte("warm"), PublishOptions{Channels: []string{"ticker"}}) //nolint:errcheck // uses the budget
+	id, err := server.PublishWithID([]byte("both"), PublishOptions{Channels: []string{"ticker", "all"}})
+	if err != nil || id == "" {
+		t.Fatalf("expected the message sent to all right away, got %q (err %v)", id, err)
+	}
+	time.Sleep(120 * time.Millisecond)
+
+	for channels, st := range streams {
+		if n := Count(st.Output(), "data: both"); n != 1 {
+			t.Errorf("%s: expected the message once, got %q", channels, st.Output())
+		}
+		if channels != "ticker" && !Contains(st.Output(), "id: "+id+"\ndata: both\n") {
+			t.Errorf("%s: expected the message with ID %s, got %q", channels, id, st.Output())
+		}
+	}
+	assertAscendingIDs(t, streams["ticker"].Output())
+}
+
+func TestPublishRateLimitThrottleHoldsOneCopy(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     headerChannels{},
+		PublishRateLimits:   []PublishRateLimit{{Channels: []string{"a", "b"}, Rate: 20, Policy: RateThrottle}},
+	})
+	streams := map[string]*mockStreamer{}
+	for _, channels := range []string{"a", "b", "a,b,all"} {
+		st := newMockStreamer()
+		st.SetHeader("X-Channels", channels)
+		go server.StreamHandler()(st)
+		streams[channels] = st
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	server.PublishWith([]byte("warm"), PublishOptions{Channels: []string{"a", "b"}}) //nolint:errcheck // uses the budgets
+	server.PublishWith([]byte("held"), PublishOptions{Channels: []string{"a", "b"}}) //nolint:errcheck
+	server.Publish([]byte("newer"), "all")
+	time.Sleep(120 * time.Millisecond)
+
+	for channels, st := range streams {
+		if n := Count(st.Output(), "data: held"); n != 1 {
+			t.Errorf("%s: expected the held message once, got %q", channels, st.Output())
+		}
+		assertAscendingIDs(t, st.Output())
+	}
+}
+
+// assertAscendingIDs fails unless the IDs of the frames in out increase.
+func assertAscendingIDs(t *testing.T, out string) {
+	t.Helper()
+	var last int64
+	for _, line := range Split(out, "\n") {
+		if !HasPrefix(line, "id: ") {
+			continue
+		}
+		id, err := Convert(line[4:]).Int64()
+		if err != nil || id <= last {
+			t.Fatalf("expected ascending IDs, got %q", out)
+		}
+		last = id
+	}
+}
+
+func TestPublishRateLimitAppliesToTargets(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     headerChannels{},
+		PublishRateLimits:   []PublishRateLimit{{Channels: []string{"all"}, Rate: 1, Burst: 2}},
+	})
+	st := newMockStreamer()
+	st.SetHeader("X-Channels", "all")
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		err = server.PublishWith([]byte("flood"), PublishOptions{Target: "all - user:1"})
+	}
+	var sseErr *SSEError
+	if !errors.As(err, &sseErr) || sseErr.Kind != ErrorRateLimited {
+		t.Fatalf("expected targeted publishes to be rate limited, got %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := Count(st.Output(), "data: flood"); n != 2 {
+		t.Errorf("expected only the burst delivered, got %d", n)
+	}
+}
@@ -0,0 +1,300 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// ackAll acknowledges ids on behalf of the stream st.
+func ackAll(t *testing.T, server *SSEServer, st *mockStreamer, ids ...string) {
+	t.Helper()
+	req := newRequest("/events/ack", JoinSlice(ids, ","))
+	req.SetHeader(HeaderConnection, connectionID(t, st))
+	req.SetHeader("X-User", st.GetHeader("X-User"))
+	server.AckHandler()(req)
+	if req.Status != 204 {
+		t.Fatalf("ack: expected 204, got %d %s", req.Status, req.Output())
+	}
+}
+
+func TestReliableRedeliversUnackedOnReconnect(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"notify", "chat"}}},
+		Metrics:             reg,
+		ReliableChannels:    []string{"notify"},
+	})
+
+	first := connectAs(server, "alice")
+	n1 := publishID(t, server, "n1", "notify")
+	server.Publish([]byte("c1"), "chat")
+	time.Sleep(30 * time.Millisecond)
+	ackAll(t, server, first, n1) // n1 received and acknowledged
+
+	first.Close()
+	n2 := publishID(t, server, "n2", "notify") // lost: the write fails
+	time.Sleep(30 * time.Millisecond)
+	if got := reg.Value(MetricMessagesPending); got != 1 {
+		t.Errorf("expected 1 pending message, got %v", got)
+	}
+
+	second := connectAs(server, "alice")
+	out := second.Output()
+	if !Contains(out, "id: "+n2+"\ndata: n2\n") {
+		t.Errorf("expected n2 to be redelivered, got %q", out)
+	}
+	if Contains(out, "data: n1\n") || Contains(out, "data: c1\n") {
+		t.Errorf("acknowledged and unreliable messages must not be redelivered, got %q", out)
+	}
+
+	ackAll(t, server, second, n2)
+	third := connectAs(server, "alice")
+	if Contains(third.Output(), "data: n2") {
+		t.Error("acknowledged message redelivered")
+	}
+	if got := reg.Value(MetricMessagesPending); got != 0 {
+		t.Errorf("expected nothing pending, got %v", got)
+	}
+
+	other := connectAs(server, "bob")
+	if Contains(other.Output(), "data: n") {
+		t.Errorf("other identities must not receive alice's pending messages, got %q", other.Output())
+	}
+}
+
+func TestReliableRedeliversWhileConnected(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer:    10,
+		ChannelProvider:        &identityProvider{mockChannelProvider{channels: []string{"notify"}}},
+		ReliableChannels:       []string{"notify"},
+		ReliableRedeliverAfter: 40 * time.Millisecond,
+	})
+	defer server.Shutdown()
+
+	st := connectAs(server, "alice")
+	n1 := publishID(t, server, "n1", "notify")
+	time.Sleep(120 * time.Millisecond)
+	if n := Count(st.Output(), "data: n1"); n < 2 {
+		t.Fatalf("expected n1 to be redelivered until acknowledged, got %d deliveries", n)
+	}
+
+	ackAll(t, server, st, n1)
+	delivered := Count(st.Output(), "data: n1")
+	time.Sleep(120 * time.Millisecond)
+	if n := Count(st.Output(), "data: n1"); n != delivered {
+		t.Errorf("redelivered after ack: %d -> %d", delivered, n)
+	}
+}
+
+func TestReliableCapsPendingPerKey(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"notify"}}},
+		ReliableChannels:    []string{"notify"},
+		ReliableMaxPending:  2,
+	})
+
+	disconnect(server, connectAs(server, "alice"), "notify") // leaves the ping pending
+	for _, n := range []string{"n1", "n2", "n3"} {
+		server.Publish([]byte(n), "notify")
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	out := connectAs(server, "alice").Output()
+	if Contains(out, "n1") || !Contains(out, "n2") || !Contains(out, "n3") {
+		t.Errorf("expected only the 2 newest pending messages, got %q", out)
+	}
+}
+
+func TestAckHandlerUnknownConnection(t *testing.T) {
+	server := New(&Config{}).Server(&ServerConfig{ChannelProvider: &mockChannelProvider{channels: []string{"all"}}})
+	req := newRequest("/events/ack", "1")
+	req.SetHeader(HeaderConnection, "nope")
+	server.AckHandler()(req)
+	if req.Status != 404 {
+		t.Errorf("expected 404, got %d", req.Status)
+	}
+}
+
+func TestAckHandlerRequiresOwner(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"notify"}}},
+		ReliableChannels:    []string{"notify"},
+	})
+	st := connectAs(server, "alice")
+	n1 := publishID(t, server, "n1", "notify")
+	time.Sleep(20 * time.Millisecond)
+
+	for _, user := range []string{"mallory", ""} {
+		req := newRequest("/events/ack", n1)
+		req.SetHeader(HeaderConnection, connectionID(t, st))
+		req.SetHeader("X-User", user)
+		server.AckHandler()(req)
+		if req.Status != 403 {
+			t.Errorf("ack as %q: expected 403, got %d", user, req.Status)
+		}
+	}
+	st.Close()
+	if out := connectAs(server, "alice").Output(); !Contains(out, "data: n1") {
+		t.Errorf("a rejected ack must keep n1 pending, got %q", out)
+	}
+}
+
+func TestReliableSkipsAnonymousConnections(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"notify"}},
+		Metrics:             reg,
+		ReliableChannels:    []string{"notify"},
+	})
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(20 * time.Millisecond)
+	server.Publish([]byte("n1"), "notify")
+	time.Sleep(20 * time.Millisecond)
+	if got := reg.Value(MetricMessagesPending); got != 0 {
+		t.Errorf("connections without identity must not keep pending messages, got %v", got)
+	}
+}
+
+func TestMessageIDsGrowAcrossRestarts(t *testing.T) {
+	newServer := func() *SSEServer {
+		return New(&Config{Log: testLog(t)}).Server(&ServerConfig{ChannelProvider: &mockChannelProvider{channels: []string{"all"}}})
+	}
+	before := publishID(t, newServer(), "m", "all")
+	time.Sleep(time.Millisecond)
+	after := publishID(t, newServer(), "m", "all")
+
+	b, _ := Convert(before).Int64()
+	a, _ := Convert(after).Int64()
+	if a <= b {
+		t.Errorf("a restarted server must continue above the last ID %s, got %s", before, after)
+	}
+}
+
+func TestReliableSkipsOrigin(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer:    10,
+		ChannelProvider:        &identityProvider{mockChannelProvider{channels: []string{"notify"}}},
+		Metrics:                reg,
+		ReliableChannels:       []string{"notify"},
+		ReliableRedeliverAfter: 40 * time.Millisecond,
+	})
+	defer server.Shutdown()
+	alice := connectAs(server, "alice")
+	bob := connectAs(server, "bob")
+
+	// alice's own echo is neither pending for her nor redelivered to her.
+	server.PublishWith([]byte("mine"), PublishOptions{Channels: []string{"notify"}, OriginKey: "alice"})
+	server.PublishWith([]byte("tab"), PublishOptions{Channels: []string{"notify"}, Origin: connectionID(t, alice)})
+	time.Sleep(120 * time.Millisecond)
+	if out := alice.Output(); Contains(out, "data: mine") || Contains(out, "data: tab") {
+		t.Errorf("the origin must not get its echo, got %q", out)
+	}
+	if got := reg.Value(MetricMessagesPending); got != 2 {
+		t.Errorf("expected only bob's 2 messages pending, got %v", got)
+	}
+	alice.Close()
+	if out := connectAs(server, "alice").Output(); Contains(out, "data: mine") || Contains(out, "data: tab") {
+		t.Errorf("the echo must not be redelivered on reconnect, got %q", out)
+	}
+	if n := Count(bob.Output(), "data: mine"); n < 2 {
+		t.Errorf("expected bob to get mine redelivered until acknowledged, got %d", n)
+	}
+}
+
+// headerIdentity reads channels from X-Channels and the identity from X-User.
+type headerIdentity struct{ headerChannels }
+
+func (headerIdentity) ResolveIdentity(ctx router.Context) (string, []byte) {
+	return ctx.GetHeader("X-User"), nil
+}
+
+// connectUser opens a stream of user subscribed to the comma-separated channels.
+func connectUser(server *SSEServer, user, channels string) *mockStreamer {
+	st := newMockStreamer()
+	st.SetHeader("X-User", user)
+	st.SetHeader("X-Channels", channels)
+	go server.StreamHandler()(st)
+	time.Sleep(20 * time.Millisecond)
+	return st
+}
+
+func TestReliableTracksTargetMessages(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     headerIdentity{},
+		ReliableChannels:    []string{"notify"},
+	})
+	admin := connectUser(server, "ann", "notify,role:admin")
+	user := connectUser(server, "uma", "notify")
+
+	server.PublishWith([]byte("admins"), PublishOptions{Target: "notify & role:admin"})
+	time.Sleep(20 * time.Millisecond)
+	admin.Close()
+	user.Close()
+
+	if out := connectUser(server, "ann", "notify,role:admin").Output(); !Contains(out, "data: admins") {
+		t.Errorf("a targeted message on a reliable channel must be redelivered, got %q", out)
+	}
+	if out := connectUser(server, "uma", "notify").Output(); Contains(out, "data: admins") {
+		t.Errorf("identities outside the target must not get it, got %q", out)
+	}
+}
+
+func TestReliableIgnoresUntrackedTabs(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer:    10,
+		ChannelProvider:        headerIdentity{},
+		ReliableChannels:       []string{"notify"},
+		ReliableRedeliverAfter: 40 * time.Millisecond,
+		ReliableRetention:      time.Millisecond,
+	})
+	defer server.Shutdown()
+
+	tracked := connectUser(server, "alice", "notify")
+	other := connectUser(server, "alice", "chat")
+	server.Disconnect(connectionID(t, other))
+
+	server.Publish([]byte("n1"), "notify")
+	time.Sleep(200 * time.Millisecond)
+	if n := Count(tracked.Output(), "data: n1\n"); n < 2 {
+		t.Errorf("closing an untracked tab must not stop redelivery, got n1 %d times", n)
+	}
+}
+
+func TestReliableFollowsSubscriptions(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     headerIdentity{},
+		Metrics:             reg,
+		ReliableChannels:    []string{"notify"},
+	})
+	alice := connectUser(server, "alice", "chat")
+	conn := connectionID(t, alice)
+
+	server.Subscribe(conn, "notify")
+	server.Publish([]byte("n1"), "notify")
+	time.Sleep(20 * time.Millisecond)
+	if got := reg.Value(MetricMessagesPending); got != 1 {
+		t.Errorf("expected a subscribed reliable channel to be tracked, got %v pending", got)
+	}
+
+	server.Unsubscribe(conn, "notify")
+	server.Publish([]byte("n2"), "notify")
+	time.Sleep(20 * time.Millisecond)
+	if got := reg.Value(MetricMessagesPending); got != 1 {
+		t.Errorf("expected a left channel to stop being tracked, got %v pending", got)
+	}
+}
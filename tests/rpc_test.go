@@ -0,0 +1,101 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallRepliesOnCallersConnection(t *testing.T) {
+	calls := make(chan *SSEMessage, 4)
+	var callerConn string
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:1"}}},
+		Metrics:             reg,
+		OnCall: func(conn ConnectionInfo, call *SSEMessage) error {
+			if call.Event == "forbidden" {
+				return Forbidden("no")
+			}
+			callerConn = conn.ID
+			calls <- call
+			return nil
+		},
+	})
+	alice := connectAs(server, "alice")
+	bob := connectAs(server, "bob")
+	aliceID := connectionID(t, alice)
+	handler := server.CallHandler()
+
+	call := func(connID, callID, method, body string) *request {
+		req := newRequest("/events/call", body)
+		req.SetHeader("X-User", "alice")
+		req.SetHeader(HeaderConnection, connID)
+		req.SetHeader(HeaderCall, callID)
+		req.SetHeader(HeaderPublishEvent, method)
+		handler(req)
+		return req
+	}
+
+	if req := call(aliceID, "7", "job.start", "args"); req.Status != 202 {
+		t.Fatalf("expected 202, got %d %s", req.Status, req.Output())
+	}
+	got := <-calls
+	if got.Id != "7" || got.Event != "job.start" || string(got.Data) != "args" || callerConn != aliceID {
+		t.Fatalf("unexpected call %+v from %s", got, callerConn)
+	}
+
+	// The handler answers later, from another goroutine.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		server.Reply(callerConn, got.Id, []byte("result"))
+		server.ReplyError(callerConn, "8", RateLimited("busy", 1))
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	out := alice.Output()
+	if !strings.Contains(out, "event: "+ReplyEvent+"\ndata: 7\ndata: \ndata: result\n") {
+		t.Errorf("reply not delivered to the caller: %q", out)
+	}
+	if !strings.Contains(out, "data: 8\ndata: rate_limited\ndata: busy\n") {
+		t.Errorf("error reply not delivered: %q", out)
+	}
+	if strings.Contains(bob.Output(), ReplyEvent) {
+		t.Error("reply leaked to another connection")
+	}
+	if reg.Value(MetricCallsReplied, "result", "ok") != 1 || reg.Value(MetricCallsReplied, "result", "rate_limited") != 1 {
+		t.Error("replies not counted")
+	}
+	if server.Reply("gone", "9", nil) {
+		t.Error("reply to an unknown connection should report false")
+	}
+
+	cases := []struct {
+		name           string
+		connID, callID string
+		method         string
+		status         int
+	}{
+		{"missing call ID", aliceID, "", "job.start", 400},
+		{"unknown connection", "nope", "9", "job.start", 404},
+		{"handler rejects", aliceID, "9", "forbidden", 403},
+	}
+	for _, c := range cases {
+		if req := call(c.connID, c.callID, c.method, ""); req.Status != c.status {
+			t.Errorf("%s: expected %d, got %d", c.name, c.status, req.Status)
+		}
+	}
+}
+
+func TestCallHandlerDisabled(t *testing.T) {
+	server := New(&Config{}).Server(&ServerConfig{ChannelProvider: &mockChannelProvider{channels: []string{"all"}}})
+	req := newRequest("/events/call", "x")
+	server.CallHandler()(req)
+	if req.Status != 501 {
+		t.Errorf("expected 501 without OnCall, got %d", req.Status)
+	}
+}
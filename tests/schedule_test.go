@@ -0,0 +1,165 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// memorySchedule is a ScheduleStore kept in a map.
+type memorySchedule struct {
+	mu    sync.Mutex
+	items map[string]*ScheduledPublish
+}
+
+func (m *memorySchedule) Save(p *ScheduledPublish) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[p.Id] = p
+	return nil
+}
+
+func (m *memorySchedule) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, id)
+	return nil
+}
+
+func (m *memorySchedule) Load() ([]*ScheduledPublish, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []*ScheduledPublish
+	for _, p := range m.items {
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func (m *memorySchedule) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.items)
+}
+
+func TestPublishAfterAndCancel(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+	})
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(20 * time.Millisecond)
+
+	opts := PublishOptions{Event: "reminder", Channels: []string{"all"}}
+	server.PublishAfter(60*time.Millisecond, []byte("second"), opts)
+	server.PublishAfter(30*time.Millisecond, []byte("first"), opts)
+	canceled, err := server.PublishAfter(40*time.Millisecond, []byte("canceled"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !canceled.Cancel() || canceled.Cancel() {
+		t.Error("Cancel should succeed once")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if Contains(st.Output(), "reminder") {
+		t.Fatalf("published too early: %q", st.Output())
+	}
+	time.Sleep(90 * time.Millisecond)
+	out := st.Output()
+	if i, j := Index(out, "data: first"), Index(out, "data: second"); i < 0 || j < i {
+		t.Errorf("expected first then second, got %q", out)
+	}
+	if Contains(out, "canceled") {
+		t.Errorf("canceled publish was sent: %q", out)
+	}
+
+	if _, err := server.PublishAt(time.Now(), nil, PublishOptions{Target: "a &"}); err == nil {
+		t.Error("an invalid target must be rejected when scheduling")
+	}
+}
+
+func TestScheduleSurvivesShutdown(t *testing.T) {
+	store := &memorySchedule{items: map[string]*ScheduledPublish{}}
+	opts := PublishOptions{Event: "maintenance", Channels: []string{"all", "ops"}}
+
+	first := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ChannelProvider: &mockChannelProvider{channels: []string{"all"}},
+		ScheduleStore:   store,
+	})
+	first.PublishAfter(50*time.Millisecond, []byte("starting"), opts)
+	dropped, _ := first.PublishAfter(50*time.Millisecond, []byte("dropped"), opts)
+	first.Shutdown()
+	if store.len() != 2 {
+		t.Fatalf("expected 2 stored publishes, got %d", store.len())
+	}
+	if _, err := first.PublishAfter(time.Millisecond, nil, opts); err == nil {
+		t.Error("scheduling after Shutdown must fail")
+	}
+
+	second := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"ops"}},
+		ScheduleStore:       store,
+	})
+	if !second.CancelScheduled(dropped.ID()) {
+		t.Error("a loaded publish should be cancelable by ID")
+	}
+	st := newMockStreamer()
+	go second.StreamHandler()(st)
+	time.Sleep(100 * time.Millisecond)
+
+	out := st.Output()
+	if !Contains(out, "event: maintenance\ndata: starting\n") || Contains(out, "dropped") {
+		t.Errorf("expected only the loaded publish, got %q", out)
+	}
+	if store.len() != 0 {
+		t.Errorf("fired and canceled publishes must leave the store, %d left", store.len())
+	}
+}
+
+func TestScheduleStoreKeepsAllOptions(t *testing.T) {
+	store := &memorySchedule{items: map[string]*ScheduledPublish{}}
+	opts := PublishOptions{
+		Event:          "note",
+		Channels:       []string{"room:1"},
+		ConflationKey:  "c",
+		IdempotencyKey: "i",
+		Encoding:       EncodingBase64,
+		OriginKey:      "alice",
+	}
+	first := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ChannelProvider: &mockChannelProvider{channels: []string{"room:1"}},
+		ScheduleStore:   store,
+	})
+	first.PublishAfter(80*time.Millisecond, []byte("hi"), opts)
+	first.Shutdown()
+
+	stored, _ := store.Load()
+	if len(stored) != 1 || stored[0].ConflationKey != "c" || stored[0].IdempotencyKey != "i" ||
+		stored[0].Encoding != int64(EncodingBase64) || stored[0].OriginKey != "alice" {
+		t.Fatalf("expected every option stored, got %+v", stored)
+	}
+
+	second := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:1"}}},
+		ScheduleStore:       store,
+	})
+	defer second.Shutdown()
+	alice := connectAs(second, "alice")
+	bob := connectAs(second, "bob")
+	time.Sleep(100 * time.Millisecond)
+	if Contains(alice.Output(), "event: note") {
+		t.Errorf("OriginKey must survive the restart, alice got %q", alice.Output())
+	}
+	if !Contains(bob.Output(), "event: note\ndata: "+MarkerBase64) {
+		t.Errorf("Encoding must survive the restart, bob got %q", bob.Output())
+	}
+}
@@ -30,6 +30,8 @@ type mockStreamer struct {
 	flushCount int
 	// done cierra la conexión simulada desde el test
 	done chan struct{}
+	// paused bloquea Write para simular un cliente lento
+	paused sync.Mutex
 }
 
 func newMockStreamer() *mockStreamer {
@@ -49,6 +51,29 @@ func (m *mockStreamer) FlushCount() int {
 	return m.flushCount
 }
 
+// Write falla una vez cerrada la conexión simulada, como haría el transporte real.
+func (m *mockStreamer) Write(b []byte) (int, error) {
+	m.paused.Lock()
+	m.paused.Unlock() //nolint:staticcheck // solo espera a Resume
+	select {
+	case <-m.done:
+		return 0, Err("connection closed")
+	default:
+	}
+	return m.Context.Write(b)
+}
+
+// Pause bloquea las escrituras hasta Resume (cliente lento).
+func (m *mockStreamer) Pause() { m.paused.Lock() }
+
+// Resume desbloquea las escrituras pausadas.
+func (m *mockStreamer) Resume() { m.paused.Unlock() }
+
+// Close simula la desconexión del cliente: el siguiente Write falla.
+func (m *mockStreamer) Close() {
+	close(m.done)
+}
+
 // Output devuelve el cuerpo de respuesta bufferizado.
 func (m *mockStreamer) Output() string {
 	return string(m.ResponseBody())
@@ -98,6 +123,38 @@ func TestStreamHandlerChannelProviderError(t *testing.T) {
 	}
 }
 
+func TestStreamHandlerTypedRejections(t *testing.T) {
+	cases := []struct {
+		err        error
+		status     int
+		kind       string
+		retryAfter string
+	}{
+		{Unauthorized("login required"), 401, "unauthorized", ""},
+		{Forbidden("not a member"), 403, "forbidden", ""},
+		{RateLimited("slow down", 30), 429, "rate_limited", "30"},
+		{Gone("account closed"), 410, "gone", ""},
+		{Err("plain error"), 401, "unauthorized", ""},
+		{&SSEError{Kind: ErrorForbidden, Message: "no status"}, 403, "forbidden", ""},
+	}
+
+	for _, c := range cases {
+		server := New(&Config{}).Server(&ServerConfig{ChannelProvider: &mockChannelProvider{err: c.err}})
+		st := newMockStreamer()
+		server.StreamHandler()(st)
+
+		if st.Status != c.status {
+			t.Errorf("%v: expected status %d, got %d", c.err, c.status, st.Status)
+		}
+		if got := st.GetHeader(ErrorHeader); got != c.kind {
+			t.Errorf("%v: expected %s %q, got %q", c.err, ErrorHeader, c.kind, got)
+		}
+		if got := st.GetHeader("Retry-After"); got != c.retryAfter {
+			t.Errorf("%v: expected Retry-After %q, got %q", c.err, c.retryAfter, got)
+		}
+	}
+}
+
 func TestStreamHandlerPublishEvent(t *testing.T) {
 	cfg := &Config{Log: testLog(t)}
 	tSSE := New(cfg)
@@ -183,15 +240,15 @@ func TestStreamHandlerHistoryReplay(t *testing.T) {
 	})
 
 	// Publicar antes de conectar
-	server.Publish([]byte("msg1"), "all")
+	first := publishID(t, server, "msg1", "all")
 	server.Publish([]byte("msg2"), "all")
 	server.Publish([]byte("msg3"), "all")
 
 	time.Sleep(30 * time.Millisecond)
 
-	// Conectar con Last-Event-ID = "1" → debe recibir msg2 y msg3
+	// Conectar con Last-Event-ID de msg1 → debe recibir msg2 y msg3
 	st := newMockStreamer()
-	st.SetHeader("Last-Event-ID", "1") // simula request header de entrada
+	st.SetHeader("Last-Event-ID", first) // simula request header de entrada
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -218,3 +275,31 @@ func TestStreamHandlerHistoryReplay(t *testing.T) {
 	// El handler sigue bloqueado en range — no es un error, el test terminó.
 	_ = &wg
 }
+
+func TestStreamHandlerBinaryPayloadEncoding(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		PayloadEncoding:     EncodingAuto,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"bin"}},
+	})
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+
+	binary := []byte{'a', '\r', 'b', 0xff}
+	server.Publish(binary, "bin")
+	server.PublishWith([]byte("forced"), PublishOptions{Channels: []string{"bin"}, Encoding: EncodingBase64URL})
+	time.Sleep(50 * time.Millisecond)
+
+	out := st.Output()
+	if Contains(out, "a\rb") {
+		t.Fatalf("raw carriage return leaked into the stream: %q", out)
+	}
+	if !Contains(out, "data: "+string(EncodePayload(binary, EncodingBase64))+"\n") {
+		t.Errorf("expected base64 payload with marker, got %q", out)
+	}
+	if !Contains(out, "data: "+MarkerBase64URL) {
+		t.Errorf("expected per-message base64url override, got %q", out)
+	}
+}
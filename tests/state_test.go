@@ -0,0 +1,119 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestStateChannelsSendLatestValuePerKey(t *testing.T) {
+	var connID string
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		StateChannels:       []string{"price:*"},
+		ChannelProvider:     &mockChannelProvider{channels: []string{"price:crypto"}},
+		OnConnect:           func(c ConnectionInfo) { connID = c.ID },
+	})
+
+	server.PublishWith([]byte("btc-1"), PublishOptions{Event: "price", Key: "BTC", Channels: []string{"price:crypto"}})
+	server.PublishWith([]byte("eth-1"), PublishOptions{Event: "price", Key: "ETH", Channels: []string{"price:crypto"}})
+	server.PublishWith([]byte("btc-2"), PublishOptions{Event: "price", Key: "BTC", Channels: []string{"price:crypto"}})
+	server.PublishEvent("status", []byte("open"), "market") // not a state channel
+	time.Sleep(20 * time.Millisecond)
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+
+	server.PublishWith([]byte("btc-3"), PublishOptions{Event: "price", Key: "BTC", Channels: []string{"price:crypto"}})
+	time.Sleep(50 * time.Millisecond)
+
+	out := st.Output()
+	if Contains(out, "btc-1") {
+		t.Error("stale value for BTC was delivered")
+	}
+	eth, btc2, btc3 := Index(out, "data: eth-1"), Index(out, "data: btc-2"), Index(out, "data: btc-3")
+	if eth < 0 || btc2 < 0 || btc3 < 0 {
+		t.Fatalf("missing state or live values: %s", out)
+	}
+	if !(eth < btc2 && btc2 < btc3) {
+		t.Errorf("expected cached state oldest first, before live traffic: %s", out)
+	}
+
+	// Dynamic subscribe delivers the cached state of the new channel.
+	server.PublishWith([]byte("eur"), PublishOptions{Event: "rate", Channels: []string{"price:fx"}})
+	time.Sleep(20 * time.Millisecond)
+	if !server.Subscribe(connID, "price:fx") {
+		t.Fatal("Subscribe returned false for an open connection")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !Contains(st.Output(), "data: eur") {
+		t.Errorf("missing state after subscribe: %s", st.Output())
+	}
+
+	if server.Subscribe("unknown", "price:fx") {
+		t.Error("Subscribe should fail for an unknown connection")
+	}
+}
+
+func TestStateChannelsSkipSeenOnReconnect(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		StateChannels:       []string{"build"},
+		ChannelProvider:     &mockChannelProvider{channels: []string{"build"}},
+	})
+
+	server.PublishEvent("status", []byte("queued"), "build")
+	seen, _ := server.PublishWithID([]byte("10%"), PublishOptions{Event: "progress", Channels: []string{"build"}})
+	server.PublishEvent("status", []byte("running"), "build")
+	time.Sleep(20 * time.Millisecond)
+
+	// Already saw "10%": it must not be resent; "running" arrives once via replay.
+	st := newMockStreamer()
+	st.SetHeader("Last-Event-ID", seen)
+	go server.StreamHandler()(st)
+	time.Sleep(50 * time.Millisecond)
+
+	out := st.Output()
+	if Contains(out, "10%") || Contains(out, "queued") {
+		t.Errorf("already seen messages were resent: %s", out)
+	}
+	if n := Count(out, "data: running"); n != 1 {
+		t.Errorf("expected latest status once, got %d: %s", n, out)
+	}
+}
+
+func TestStateChannelsForgetIdleChannels(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		StateChannels:       []string{"room:*"},
+		StateRetention:      30 * time.Millisecond,
+		ExpirySweepInterval: 10 * time.Millisecond,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"room:1"}},
+	})
+
+	server.PublishEvent("topic", []byte("old news"), "room:1")
+	time.Sleep(80 * time.Millisecond)
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	if Contains(st.Output(), "old news") {
+		t.Errorf("state of an idle channel must be forgotten, got %q", st.Output())
+	}
+
+	// While subscribed, state is kept past the retention.
+	server.PublishEvent("topic", []byte("fresh"), "room:1")
+	time.Sleep(80 * time.Millisecond)
+	late := newMockStreamer()
+	go server.StreamHandler()(late)
+	time.Sleep(30 * time.Millisecond)
+	if !Contains(late.Output(), "data: fresh") {
+		t.Errorf("state of a channel with subscribers must be kept, got %q", late.Output())
+	}
+}
@@ -0,0 +1,119 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+	"github.com/tinywasm/router"
+)
+
+// headerChannels subscribes each connection to the channels in its X-Channels header.
+type headerChannels struct{}
+
+func (headerChannels) ResolveChannels(ctx router.Context) ([]string, error) {
+	return Split(ctx.GetHeader("X-Channels"), ","), nil
+}
+
+func TestPublishTargetExpressions(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 20,
+		ChannelProvider:     headerChannels{},
+	})
+	conns := map[string]string{
+		"admin7":  "all,tenant:7,role:admin,user:1",
+		"member7": "all,tenant:7,user:2",
+		"admin8":  "all,tenant:8,role:admin,user:3",
+		"guest":   "all,user:123",
+	}
+	streams := map[string]*mockStreamer{}
+	for name, channels := range conns {
+		st := newMockStreamer()
+		st.SetHeader("X-Channels", channels)
+		go server.StreamHandler()(st)
+		streams[name] = st
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	cases := []struct {
+		target string
+		want   []string
+	}{
+		{"tenant:7 & role:admin", []string{"admin7"}},
+		{"all - user:123", []string{"admin7", "member7", "admin8"}},
+		// & binds tighter than -, which binds tighter than |.
+		{"all - tenant:7 & role:admin", []string{"member7", "admin8", "guest"}},
+		{"(all - tenant:7) & role:admin", []string{"admin8"}},
+		{"tenant:8 | user:123 - all", []string{"admin8"}},
+		{"(tenant:8 | user:123) - all", nil},
+		{"user:123 | tenant:7 & role:admin", []string{"admin7", "guest"}},
+		{"all - user:1 - user:2", []string{"admin8", "guest"}},
+		// Empty results are not an error.
+		{"tenant:7 & tenant:8", nil},
+		{"all - all", nil},
+		{"nobody", nil},
+	}
+	for i, c := range cases {
+		event := "t" + Convert(i).String()
+		if err := server.PublishWith([]byte(c.target), PublishOptions{Event: event, Target: c.target}); err != nil {
+			t.Fatalf("%q: %v", c.target, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		for name, st := range streams {
+			got := Contains(st.Output(), "event: "+event+"\n")
+			if got != containsName(c.want, name) {
+				t.Errorf("%q: %s received=%v, want %v", c.target, name, got, c.want)
+			}
+		}
+	}
+}
+
+func containsName(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPublishTargetInvalid(t *testing.T) {
+	server := New(&Config{}).Server(&ServerConfig{ChannelProvider: headerChannels{}})
+	for _, target := range []string{"a &", "& a", "(a | b", "a b", "a )", "a - - b", "a -b"} {
+		if err := server.PublishWith(nil, PublishOptions{Target: target}); err == nil {
+			t.Errorf("%q: expected a parse error", target)
+		}
+	}
+	if err := server.PublishWith(nil, PublishOptions{Target: "room-a - user:1"}); err != nil {
+		t.Errorf("hyphenated channel names must parse: %v", err)
+	}
+}
+
+func TestPublishTargetReplaysToMatchingOnly(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ChannelProvider:     headerChannels{},
+	})
+	first := publishID(t, server, "first", "all")
+	server.PublishWith([]byte("admins"), PublishOptions{Target: "all & role:admin"})
+	time.Sleep(20 * time.Millisecond)
+
+	replay := func(channels string) string {
+		st := newMockStreamer()
+		st.SetHeader("X-Channels", channels)
+		st.SetHeader("Last-Event-ID", first)
+		go server.StreamHandler()(st)
+		time.Sleep(30 * time.Millisecond)
+		return st.Output()
+	}
+	if out := replay("all,role:admin"); !Contains(out, "data: admins") {
+		t.Errorf("matching connection should replay the targeted message, got %q", out)
+	}
+	if out := replay("all"); Contains(out, "data: admins") {
+		t.Errorf("non-matching connection replayed the targeted message: %q", out)
+	}
+}
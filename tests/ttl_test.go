@@ -0,0 +1,137 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"testing"
+	"time"
+
+	. "github.com/tinywasm/fmt"
+)
+
+func TestMessageTTLSkipsReplay(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ReplayAllOnConnect:  true,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+	})
+	server.PublishWith([]byte("short"), PublishOptions{Channels: []string{"all"}, TTL: 20 * time.Millisecond})
+	server.PublishWith([]byte("long"), PublishOptions{Channels: []string{"all"}, TTL: time.Hour})
+	server.Publish([]byte("forever"), "all")
+	time.Sleep(40 * time.Millisecond)
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	out := st.Output()
+	if Contains(out, "data: short") {
+		t.Errorf("expired message replayed: %q", out)
+	}
+	if !Contains(out, "data: long") || !Contains(out, "data: forever") {
+		t.Errorf("unexpired messages must be replayed: %q", out)
+	}
+}
+
+func TestMessageTTLDropsFromQueue(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+		Metrics:             reg,
+	})
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(20 * time.Millisecond)
+
+	st.Pause()
+	server.Publish([]byte("blocker"), "all") // the writer blocks on it
+	time.Sleep(10 * time.Millisecond)
+	server.PublishWith([]byte("stale"), PublishOptions{Channels: []string{"all"}, TTL: 10 * time.Millisecond})
+	server.Publish([]byte("fresh"), "all")
+	time.Sleep(30 * time.Millisecond)
+	st.Resume()
+	time.Sleep(30 * time.Millisecond)
+
+	out := st.Output()
+	if Contains(out, "data: stale") || !Contains(out, "data: fresh") {
+		t.Errorf("expected only the unexpired queued message, got %q", out)
+	}
+	if got := reg.Value(MetricMessagesExpired, "where", "queue"); got != 1 {
+		t.Errorf("expected 1 message expired in queue, got %v", got)
+	}
+}
+
+func TestChannelTTLSweepsHistoryAndState(t *testing.T) {
+	reg := NewMetricsRegistry()
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"ticker:btc", "news"}},
+		StateChannels:       []string{"ticker:*", "news"},
+		MessageTTLs:         []ChannelTTL{{Channels: []string{"ticker:*"}, TTL: 20 * time.Millisecond}},
+		ExpirySweepInterval: 10 * time.Millisecond,
+		Metrics:             reg,
+	})
+	defer server.Shutdown()
+	server.PublishEvent("price", []byte("100"), "ticker:btc")
+	server.PublishEvent("headline", []byte("hello"), "news")
+	time.Sleep(60 * time.Millisecond)
+
+	if got := reg.Value(MetricHistorySize); got != 1 {
+		t.Errorf("expected the expired message swept from history, size %v", got)
+	}
+	if got := reg.Value(MetricMessagesExpired, "where", "history"); got != 1 {
+		t.Errorf("expected 1 message expired in history, got %v", got)
+	}
+
+	st := newMockStreamer()
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	if out := st.Output(); Contains(out, "data: 100") || !Contains(out, "data: hello") {
+		t.Errorf("expected only unexpired state, got %q", out)
+	}
+}
+
+func TestReplayResumesAfterExpiredLastEventID(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ChannelProvider:     &mockChannelProvider{channels: []string{"all"}},
+		ExpirySweepInterval: 10 * time.Millisecond,
+	})
+	defer server.Shutdown()
+	server.Publish([]byte("old"), "all")
+	last, _ := server.PublishWithID([]byte("seen"), PublishOptions{Channels: []string{"all"}, TTL: 10 * time.Millisecond})
+	server.Publish([]byte("missed"), "all")
+	time.Sleep(40 * time.Millisecond) // "seen" expired and was swept
+
+	st := newMockStreamer()
+	st.SetHeader("Last-Event-ID", last)
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	if out := st.Output(); !Contains(out, "data: missed") || Contains(out, "data: old") {
+		t.Errorf("expected replay after the expired ID, got %q", out)
+	}
+}
+
+func TestChannelTTLAppliesToTargets(t *testing.T) {
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		HistoryReplayBuffer: 10,
+		ReplayAllOnConnect:  true,
+		ChannelProvider:     headerChannels{},
+		MessageTTLs:         []ChannelTTL{{Channels: []string{"ticker:*"}, TTL: 20 * time.Millisecond}},
+	})
+	server.PublishWith([]byte("stale"), PublishOptions{Target: "ticker:btc & pro"})
+	time.Sleep(40 * time.Millisecond)
+
+	st := newMockStreamer()
+	st.SetHeader("X-Channels", "ticker:btc,pro")
+	go server.StreamHandler()(st)
+	time.Sleep(30 * time.Millisecond)
+	if out := st.Output(); Contains(out, "data: stale") {
+		t.Errorf("the TTL of the target's channels must apply, got %q", out)
+	}
+}
@@ -0,0 +1,101 @@
+//go:build !wasm
+
+package sse_test
+
+import (
+	. "github.com/tinywasm/sse"
+	"sync"
+	"testing"
+
+	. "github.com/tinywasm/fmt"
+)
+
+// connectionID reads the ID announced by the ConnectedEvent of st.
+func connectionID(t *testing.T, st *mockStreamer) string {
+	t.Helper()
+	prefix := "event: " + ConnectedEvent + "\ndata: "
+	out := st.Output()
+	if !HasPrefix(out, prefix) {
+		t.Fatalf("expected the stream to open with %s, got %q", ConnectedEvent, out)
+	}
+	out = out[len(prefix):]
+	return out[:Index(out, "\n")]
+}
+
+// publishID publishes data to channel and returns the message ID.
+func publishID(t *testing.T, server *SSEServer, data, channel string) string {
+	t.Helper()
+	id, err := server.PublishWithID([]byte(data), PublishOptions{Channels: []string{channel}})
+	if err != nil || id == "" {
+		t.Fatalf("publish %s: id %q, err %v", data, id, err)
+	}
+	return id
+}
+
+func TestReceiveHandlerDeliversWithConnection(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	server := New(&Config{Log: testLog(t)}).Server(&ServerConfig{
+		ClientChannelBuffer: 10,
+		ChannelProvider:     &identityProvider{mockChannelProvider{channels: []string{"room:1"}}},
+		OnReceive: func(conn ConnectionInfo, msg *SSEMessage) error {
+			if msg.Event == "bad" {
+				return Forbidden("not allowed")
+			}
+			mu.Lock()
+			got = append(got, conn.Key+"|"+JoinSlice(conn.Channels, ",")+"|"+msg.Event+"|"+string(msg.Data))
+			mu.Unlock()
+			return nil
+		},
+	})
+	st := connectAs(server, "alice")
+	id := connectionID(t, st)
+	if conns := server.Connections(); len(conns) != 1 || conns[0].ID != id {
+		t.Fatalf("announced ID %q does not match %+v", id, conns)
+	}
+	handler := server.ReceiveHandler()
+
+	send := func(connID, user, event, body string) *request {
+		req := newRequest("/events/send", body)
+		req.SetHeader(HeaderConnection, connID)
+		req.SetHeader(HeaderPublishEvent, event)
+		req.SetHeader("X-User", user)
+		handler(req)
+		return req
+	}
+
+	if req := send(id, "alice", "typing", "hi"); req.Status != 204 {
+		t.Fatalf("expected 204, got %d %s", req.Status, req.Output())
+	}
+	mu.Lock()
+	if len(got) != 1 || got[0] != "alice|room:1|typing|hi" {
+		t.Errorf("unexpected messages %v", got)
+	}
+	mu.Unlock()
+
+	cases := []struct {
+		name                string
+		connID, user, event string
+		status              int
+	}{
+		{"unknown connection", "nope", "alice", "typing", 404},
+		{"other identity", id, "mallory", "typing", 403},
+		{"no identity", id, "", "typing", 403},
+		{"handler error", id, "alice", "bad", 403},
+		{"line break in event", id, "alice", "typing\nevent: x", 400},
+	}
+	for _, c := range cases {
+		if req := send(c.connID, c.user, c.event, ""); req.Status != c.status {
+			t.Errorf("%s: expected %d, got %d", c.name, c.status, req.Status)
+		}
+	}
+}
+
+func TestReceiveHandlerDisabled(t *testing.T) {
+	server := New(&Config{}).Server(&ServerConfig{ChannelProvider: &mockChannelProvider{channels: []string{"all"}}})
+	req := newRequest("/events/send", "x")
+	server.ReceiveHandler()(req)
+	if req.Status != 501 {
+		t.Errorf("expected 501 without OnReceive, got %d", req.Status)
+	}
+}
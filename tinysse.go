@@ -3,16 +3,23 @@ package sse
 // tinySSE is the internal struct holding shared configuration.
 type tinySSE struct {
 	config *Config
+	logger Logger
 }
 
 // New creates a new tinySSE instance with shared configuration.
 func New(c *Config) *tinySSE {
-	return &tinySSE{config: c}
+	t := &tinySSE{config: c}
+	if c.Logger != nil {
+		t.logger = c.Logger
+	} else if c.Log != nil {
+		t.logger = funcLogger(c.Log)
+	}
+	return t
 }
 
-// log prints to the configured logger if one is set.
-func (t *tinySSE) log(args ...any) {
-	if t.config.Log != nil {
-		t.config.Log(args...)
+// log emits a structured entry if a logger is configured and level is enabled.
+func (t *tinySSE) log(level LogLevel, msg string, fields ...any) {
+	if t.logger != nil && level >= t.config.LogLevel {
+		t.logger.Log(level, msg, fields...)
 	}
 }
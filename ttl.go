@@ -0,0 +1,131 @@
+//go:build !wasm
+
+package sse
+
+import "time"
+
+// defaultExpirySweepInterval is used when ServerConfig.ExpirySweepInterval is 0.
+const defaultExpirySweepInterval = time.Minute
+
+// expired reports whether a message expiring at expiresAt is expired at now.
+// A zero expiresAt never expires.
+func expired(expiresAt, now time.Time) bool {
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// setExpiry applies the shortest ServerConfig.MessageTTLs of bMsg's channels
+// (those its Target reaches) unless PublishOptions.TTL already set one, and
+// starts the sweeper on the first expiring message. Must run on the hub
+// goroutine.
+func (h *hub) setExpiry(bMsg *broadcastMessage) {
+	if bMsg.expiresAt.IsZero() {
+		channels := bMsg.channels
+		if bMsg.target != nil {
+			channels = bMsg.target.reach()
+		}
+		var ttl time.Duration
+		for _, ch := range channels {
+			for _, t := range h.config.MessageTTLs {
+				if t.TTL > 0 && matchAnyChannel(t.Channels, ch) {
+					if ttl == 0 || t.TTL < ttl {
+						ttl = t.TTL
+					}
+					break
+				}
+			}
+		}
+		if ttl == 0 {
+			return
+		}
+		bMsg.expiresAt = time.Now().Add(ttl)
+	}
+	h.startSweeper()
+}
+
+// startSweeper starts the expiry sweeper on first need.
+// Must run on the hub goroutine.
+func (h *hub) startSweeper() {
+	if !h.sweeping {
+		h.sweeping = true
+		go h.runExpirySweeper()
+	}
+}
+
+// outbound returns item ready to be queued, keeping its expiry.
+func (item *historyItem) outbound() *outbound {
+	out := newOutbound(item.msg)
+	out.expiresAt = item.expiresAt
+	return out
+}
+
+// dropExpired removes the messages of batch that expired while queued.
+func (s *SSEServer) dropExpired(batch []*outbound) []*outbound {
+	now := time.Now()
+	kept := batch[:0]
+	for _, out := range batch {
+		if !expired(out.expiresAt, now) {
+			kept = append(kept, out)
+		}
+	}
+	if n := len(batch) - len(kept); n > 0 {
+		clear(batch[len(kept):])
+		s.hub.metrics.Add(MetricMessagesExpired, float64(n), "where", "queue")
+	}
+	return kept
+}
+
+// runExpirySweeper ticks sweepExpired on the hub goroutine until the hub
+// stops.
+func (h *hub) runExpirySweeper() {
+	interval := h.config.ExpirySweepInterval
+	if interval <= 0 {
+		interval = defaultExpirySweepInterval
+	}
+	h.tick(interval, h.sweepExpired)
+}
+
+// sweepExpired removes expired messages from history, the state cache and
+// reliable tracking, and idle state channels. Must run on the hub goroutine.
+func (h *hub) sweepExpired() {
+	now := time.Now()
+
+	h.historyMutex.Lock()
+	kept := make([]*historyItem, 0, cap(h.history))
+	for _, item := range h.history {
+		if !expired(item.expiresAt, now) {
+			kept = append(kept, item)
+		}
+	}
+	removed := len(h.history) - len(kept)
+	h.history = kept
+	h.historyMutex.Unlock()
+	if removed > 0 {
+		h.metrics.Add(MetricMessagesExpired, float64(removed), "where", "history")
+		h.metrics.Set(MetricHistorySize, float64(len(kept)))
+	}
+
+	for ch, entries := range h.state {
+		for key, item := range entries {
+			if expired(item.expiresAt, now) {
+				delete(entries, key)
+			}
+		}
+		if len(entries) == 0 {
+			delete(h.state, ch)
+			delete(h.stateActive, ch)
+		}
+	}
+	h.sweepState(now)
+
+	for _, m := range h.reliable {
+		pending := m.pending[:0]
+		for _, p := range m.pending {
+			if !expired(p.expiresAt, now) {
+				pending = append(pending, p)
+			}
+		}
+		clear(m.pending[len(pending):])
+		m.pending = pending
+	}
+	h.reportPending()
+}
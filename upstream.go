@@ -0,0 +1,107 @@
+//go:build !wasm
+
+package sse
+
+import "github.com/tinywasm/router"
+
+// ReceiveHandler returns the upstream handler paired with StreamHandler:
+// clients POST messages to it (see SSEClient.Send) with their connection ID
+// in the X-SSE-Connection header, the event name in X-SSE-Event and the raw
+// data as body. Messages go to ServerConfig.OnReceive with the sender's
+// ConnectionInfo. Answers 204, or 404 when the connection is not open.
+// Register it with: r.Post("/events/send", server.ReceiveHandler())
+func (s *SSEServer) ReceiveHandler() func(ctx router.Context) {
+	return func(ctx router.Context) {
+		if s.config.OnReceive == nil {
+			writeError(ctx, 501, "upstream messages not enabled")
+			return
+		}
+
+		conn, event, data, ok := s.readUpstream(ctx)
+		if !ok {
+			return
+		}
+		msg := &SSEMessage{Event: event, Data: data}
+
+		s.hub.metrics.Add(MetricMessagesReceived, 1)
+		if err := s.config.OnReceive(conn, msg); err != nil {
+			s.tinySSE.log(LevelDebug, LogReceive, "conn", conn.ID, "event", msg.Event, "error", err)
+			writeFailure(ctx, err, 400)
+			return
+		}
+		ctx.WriteStatus(204)
+	}
+}
+
+// Caller returns the open connection of the client making the request ctx,
+// named by its X-SSE-Connection header (see SSEClient.ConnectionID), e.g. to
+// pass it as PublishOptions.Origin. When the ChannelProvider implements
+// IdentityProvider, the request must also resolve to the connection's key.
+// Returns false when the header is missing, unknown or not the caller's.
+func (s *SSEServer) Caller(ctx router.Context) (ConnectionInfo, bool) {
+	conn, ok := s.connection(ctx.GetHeader(HeaderConnection))
+	if !ok {
+		return conn, false
+	}
+	return conn, s.owns(ctx, conn)
+}
+
+// owns reports whether the request ctx comes from conn's identity.
+// The connection ID is unguessable, but when identities are known the
+// sender must also be the connection's owner: a connection opened with an
+// identity only accepts requests resolving to that same identity, so an
+// anonymous request cannot act for it.
+func (s *SSEServer) owns(ctx router.Context, conn ConnectionInfo) bool {
+	ip, ok := s.config.ChannelProvider.(IdentityProvider)
+	if !ok {
+		return true
+	}
+	if conn.Key == conn.ID {
+		// Anonymous connection: only its ID identifies the owner.
+		return true
+	}
+	key, _ := ip.ResolveIdentity(ctx)
+	return key == conn.Key
+}
+
+// readUpstream returns the sender's connection, the X-SSE-Event header and
+// the request body, answering 404, 403 or 400 when the request cannot be
+// accepted.
+func (s *SSEServer) readUpstream(ctx router.Context) (ConnectionInfo, string, []byte, bool) {
+	conn, ok := s.connection(ctx.GetHeader(HeaderConnection))
+	if !ok {
+		writeError(ctx, 404, "connection not found")
+		return conn, "", nil, false
+	}
+	if !s.owns(ctx, conn) {
+		writeError(ctx, 403, "connection belongs to another identity")
+		return conn, "", nil, false
+	}
+
+	event := ctx.GetHeader(HeaderPublishEvent)
+	if !validEvent(event) {
+		writeError(ctx, 400, ErrInvalidEvent.Error())
+		return conn, "", nil, false
+	}
+	data, err := ctx.Body()
+	if err != nil {
+		writeError(ctx, 400, "invalid request body: "+err.Error())
+		return conn, "", nil, false
+	}
+	return conn, event, data, true
+}
+
+// connection returns the open connection connID.
+func (s *SSEServer) connection(connID string) (ConnectionInfo, bool) {
+	var info ConnectionInfo
+	if connID == "" {
+		return info, false
+	}
+	found := false
+	s.hub.do(func() {
+		if client := s.hub.conns[connID]; client != nil {
+			info, found = client.info(), true
+		}
+	})
+	return info, found
+}